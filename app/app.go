@@ -1,123 +1,349 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/govirtuo/cfcr/cloudflare"
 	"github.com/govirtuo/cfcr/config"
 	"github.com/govirtuo/cfcr/metrics"
 	"github.com/govirtuo/cfcr/providers"
+	"github.com/govirtuo/cfcr/publishers"
 	"github.com/rs/zerolog"
 )
 
 // App is a wrap struct around all the main config and and values that need to
 // be shared across the program.
 type App struct {
-	Logger          zerolog.Logger
-	Config          *config.Config
-	Provider        providers.Provider
-	CloudflareCredz cloudflare.Credentials
+	Logger   zerolog.Logger
+	Config   *config.Config
+	Provider providers.Provider
+	// Publisher is only needed for the certificate packs validated over HTTP
+	Publisher publishers.Publisher
+	// Cloudflare holds one client per configured Cloudflare account, indexed
+	// by account name
+	Cloudflare      map[string]*cloudflare.Client
+	CloudflareCache *cloudflare.Cache
 
 	MetricsServer *metrics.Server
+
+	customHostnames *statusTracker
 }
 
 // Create creates a new App with an initialized logger only
 func Create() (*App, error) {
 	var a App
 	a.Logger = zerolog.New(os.Stderr).With().Caller().Logger()
+	a.customHostnames = &statusTracker{status: make(map[string]cloudflare.PackStatus)}
 	return &a, nil
 }
 
-func (a App) Run(t time.Time, dryRun bool) error {
+// Run checks the certificate packs of every watched domain and custom
+// hostname once. It stops as soon as ctx is done and returns its error.
+func (a App) Run(ctx context.Context, t time.Time, dryRun bool) error {
 	a.Logger.Debug().Msgf("received ticker signal at %s", t)
-	a.Logger.Info().Msg("starting looping around listed domains")
-
-	for _, d := range a.Config.Checks.Domains {
-		subl := a.Logger.With().Str("domain", d).Logger()
 
-		subl.Info().Msg("getting zone ID on Cloudflare API")
-		id, err := cloudflare.GetZoneID(d, a.CloudflareCredz)
-		if err != nil {
-			if err == cloudflare.ErrEmptyResponse {
-				subl.Fatal().Err(err).Msg("cloudflare returned nothing, the token is probably not working")
+	// the cache is saved even if the run is interrupted, so that the lookups
+	// already done are not lost
+	if a.CloudflareCache != nil {
+		defer func() {
+			if err := a.CloudflareCache.Save(); err != nil {
+				a.Logger.Error().Err(err).Msg("cannot save Cloudflare cache")
 			}
-			subl.Error().Err(err).Msg("cannot get zone ID")
+		}()
+	}
+
+	domains := a.Domains(ctx)
+	if a.Config.Metrics.Enabled {
+		a.MetricsServer.SetNumOfDomainsMetric(len(domains))
+	}
+
+	// the accounts whose credentials are rejected are skipped for the rest
+	// of the run, without stopping the processing of the other accounts
+	rejected := make(map[string]bool)
+
+	a.Logger.Info().Msg("starting looping around listed domains")
+	for _, dom := range domains {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rejected[dom.Account] {
+			a.Logger.Warn().Str("domain", dom.Name).Str("account", dom.Account).
+				Msg("skipping domain, the credentials of its account are rejected by Cloudflare")
 			continue
 		}
+		if err := a.runDomain(ctx, dom, dryRun); cloudflare.IsAuthError(err) {
+			rejected[dom.Account] = true
+		}
+	}
 
-		subl.Debug().Msgf("got zone ID from Cloudflare: %s", id)
+	if len(a.Config.Checks.CustomHostnames) > 0 {
+		a.Logger.Info().Msg("starting looping around custom hostnames")
+		a.runCustomHostnames(ctx, rejected, dryRun)
+	}
 
-		subl.Info().Msg("checking current certificate packs status")
-		status, err := cloudflare.GetCertificatePacksStatus(id, a.CloudflareCredz)
-		if err != nil {
-			if err == cloudflare.ErrEmptyResponse {
-				subl.Fatal().Err(err).Msg("cloudflare returned nothing, the token is probably not working")
-			}
-			subl.Error().Err(err).Msg("cannot check current certificate packs status")
-			continue
+	return ctx.Err()
+}
+
+// runDomain checks the certificate packs covering the domain dom and updates
+// its validation records. The whole processing is bounded by the per-domain
+// timeout. The Cloudflare error that prevented the processing, if any, is
+// returned.
+func (a App) runDomain(ctx context.Context, dom config.Domain, dryRun bool) error {
+	ctx, cancel := context.WithTimeout(ctx, a.Config.DomainTimeout())
+	defer cancel()
+
+	d := dom.Name
+	subl := a.Logger.With().Str("domain", d).Str("account", dom.Account).Logger()
+	cf := a.Cloudflare[dom.Account]
+
+	subl.Info().Msg("resolving zone on Cloudflare API")
+	zone, err := cf.ResolveZone(ctx, d)
+	if err != nil {
+		logCloudflareError(subl, err, "cannot resolve zone")
+		return err
+	}
+	id := zone.ID
+
+	subl.Debug().Msgf("got zone %s with ID %s from Cloudflare", zone.Name, id)
+
+	subl.Info().Msg("getting certificate packs on Cloudflare API")
+	ordering := a.Config.Checks.Ordering.Enabled
+	packs, err := cf.GetCertificatePacks(ctx, id)
+	if err != nil && !(ordering && errors.Is(err, cloudflare.ErrNoResult)) {
+		logCloudflareError(subl, err, "cannot get certificate packs")
+		return err
+	}
+	subl.Debug().Msgf("got %d certificate packs from Cloudflare", len(packs))
+
+	// when the domain is not a zone by itself, the zone packs are shared
+	// with the other hostnames of the zone: only the ones covering the
+	// domain are relevant
+	if zone.Name != d {
+		packs = packsCovering(packs, d)
+		subl.Debug().Msgf("%d certificate packs are covering this domain", len(packs))
+		if len(packs) == 0 && !ordering {
+			subl.Warn().Msgf("no certificate pack of zone %s covers this domain", zone.Name)
+			return nil
 		}
+	}
 
-		if status == cloudflare.ActiveCertificate {
-			subl.Info().Msg("certificate packs are active for this domain, trying to cleanup provider's TXT records")
-			if dryRun {
-				a.Logger.Info().Msg("running in dry-mode, stopping actions now")
-				continue
-			}
+	// the ordered pack goes through the same flow as the other ones: it
+	// is usually still initializing and gets validated on the next runs
+	if ordering && cloudflare.NeedsNewPack(packs) {
+		subl.Info().Msg("no certificate pack can be renewed for this domain")
+		p, ok := a.orderPack(ctx, subl, cf, zone, d, dryRun)
+		if !ok {
+			return nil
+		}
+		packs = append(packs, p)
+	}
 
-			if err := a.Provider.CleanTXTRecords(subl, d); err != nil {
-				subl.Error().Err(err).Msgf("cannot clean certificates for %s", d)
-			}
-			continue
+	// packs validated over HTTP do not need any DNS record
+	httpPacks, packs := splitHTTPPacks(packs)
+	if len(httpPacks) > 0 {
+		a.processHTTPPacks(ctx, subl, d, httpPacks, dryRun)
+		if len(packs) == 0 {
+			return nil
 		}
-		subl.Info().Msg("certificate packs are pending for this domain")
+	}
 
-		subl.Info().Msg("getting new TXT records on Cloudflare API")
-		vals, err := cloudflare.GetTXTValues(id, a.CloudflareCredz)
-		if err != nil {
-			if err == cloudflare.ErrEmptyResponse {
-				subl.Fatal().Err(err).Msg("cloudflare returned nothing, the token is probably not working")
+	// every pack is judged on its own: the TXT records of all the pending
+	// packs are gathered and published together. Provider's records are
+	// only cleaned once no pack needs them anymore
+	var records []providers.Record
+	var pending, busy int
+	var written, timedOut []cloudflare.CertificatePack
+	revalidation := a.Config.Checks.Revalidation.Enabled
+	for _, p := range packs {
+		pl := subl.With().Str("pack", p.ID).Str("status", string(p.Status)).Logger()
+		switch p.Status.Action() {
+		case cloudflare.ActionNone:
+			pl.Info().Msgf("certificate pack %s is active", p.Type)
+			a.checkExpiry(pl, d, p)
+		case cloudflare.ActionWait:
+			pl.Info().Msgf("certificate pack %s is being processed by Cloudflare, waiting", p.Type)
+			busy++
+		case cloudflare.ActionWriteTXT, cloudflare.ActionRevalidate:
+			busy++
+			if p.Status.Action() == cloudflare.ActionRevalidate {
+				if !revalidation {
+					pl.Warn().Msgf("validation of certificate pack %s timed out, it has to be triggered again", p.Type)
+					continue
+				}
+				pl.Info().Msgf("validation of certificate pack %s timed out, it will be triggered again", p.Type)
+				timedOut = append(timedOut, p)
 			}
-			subl.Error().Err(err).Msg("cannot get new TXT records")
-			continue
+			recs := txtRecords(p.TXTRecords())
+			if len(recs) == 0 {
+				pl.Warn().Msgf("certificate pack %s is pending but has no TXT validation record", p.Type)
+				continue
+			}
+			pl.Info().Msgf("certificate pack %s is pending for hosts %s", p.Type, p.Hosts)
+			pl.Debug().Msgf("got TXT records from Cloudflare: %s", recs)
+			records = append(records, recs...)
+			written = append(written, p)
+			pending++
+		case cloudflare.ActionAlert:
+			pl.Error().Msgf("certificate pack %s for hosts %s needs a manual intervention", p.Type, p.Hosts)
+		default:
+			pl.Error().Msgf("certificate pack status '%s' is unknown", p.Status)
+			busy++
 		}
-		subl.Debug().Msgf("got TXT records from Cloudflare: %s", vals)
+	}
 
-		var txtvalues []string
-		for _, v := range vals {
-			txtvalues = append(txtvalues, v.TxtValue)
-		}
+	if pending == 0 && busy > 0 {
+		subl.Info().Msg("some certificate packs are still in progress, leaving provider's TXT records untouched")
+		return nil
+	}
 
+	if pending == 0 {
+		subl.Info().Msg("no certificate pack is pending for this domain, trying to cleanup provider's TXT records")
 		if dryRun {
 			a.Logger.Info().Msg("running in dry-mode, stopping actions now")
-			continue
+			return nil
 		}
 
-		// before creating the TXT records, we need to ensure that they do not
-		// already exist
-		ok, err := a.Provider.CheckIfRecordsAlreadyExist(subl, d)
-		if err != nil {
-			subl.Error().Err(err).Msg("cannot check if TXT records already exist")
-			continue
+		for _, name := range cleanupNames(packs, zone.Name, d) {
+			if err := a.Provider.CleanTXTRecords(ctx, subl, name); err != nil {
+				subl.Error().Err(err).Msgf("cannot clean TXT records of %s", name)
+			}
 		}
+		return nil
+	}
+	subl.Info().Msgf("%d certificate packs are pending for this domain", pending)
 
-		if ok {
-			subl.Info().Msg("TXT records are already set but the certificate packs is still not renewed, so no need to pursue")
-			continue
+	if dryRun {
+		a.Logger.Info().Msg("running in dry-mode, stopping actions now")
+		return nil
+	}
+
+	// before creating the TXT records, we need to ensure that they do not
+	// already exist
+	ok, err := a.Provider.CheckIfRecordsAlreadyExist(ctx, subl, records...)
+	if err != nil {
+		subl.Error().Err(err).Msg("cannot check if TXT records already exist")
+		return nil
+	}
+
+	if ok {
+		subl.Info().Msg("TXT records are already set but the certificate packs is still not renewed, so no need to pursue")
+		if revalidation && len(timedOut) > 0 {
+			a.revalidate(ctx, subl, cf, id, timedOut)
 		}
+		return nil
+	}
 
-		if err := a.Provider.CreateTXTRecords(subl, d, txtvalues...); err != nil {
-			a.Logger.Error().Err(err).Msg("failed to create TXT records")
-			continue
+	if err := a.Provider.CreateTXTRecords(ctx, subl, records...); err != nil {
+		a.Logger.Error().Err(err).Msg("failed to create TXT records")
+		return nil
+	}
+
+	if a.Config.Metrics.Enabled {
+		subl.Debug().Msg("updating timestamp in last updated metric")
+		a.MetricsServer.SetDomainLastUpdatedMetric(d)
+	}
+	subl.Info().Msg("domain records update completed")
+
+	if revalidation {
+		a.revalidate(ctx, subl, cf, id, written)
+	}
+	return nil
+}
+
+// logCloudflareError logs err with a level depending on its cause
+func logCloudflareError(l zerolog.Logger, err error, msg string) {
+	switch {
+	case cloudflare.IsAuthError(err):
+		l.Error().Err(err).Msgf("%s: cloudflare rejected the credentials, the token is probably not working", msg)
+	case cloudflare.IsPermissionError(err):
+		l.Error().Err(err).Msgf("%s: the token is missing some permissions", msg)
+	case cloudflare.IsRateLimited(err):
+		l.Warn().Err(err).Msgf("%s: cloudflare rate limit reached", msg)
+	case cloudflare.IsServerError(err):
+		l.Warn().Err(err).Msgf("%s: cloudflare is having issues", msg)
+	default:
+		l.Error().Err(err).Msg(msg)
+	}
+}
+
+// checkExpiry emits a warning if a certificate of the active pack p expires
+// within the configured renewal window
+func (a App) checkExpiry(l zerolog.Logger, d string, p cloudflare.CertificatePack) {
+	exp := p.ExpiresOn()
+	if exp.IsZero() {
+		l.Debug().Msg("no expiry date found in certificate pack")
+		return
+	}
+
+	if a.Config.Metrics.Enabled {
+		a.MetricsServer.SetCertificateExpiryMetric(d, p.ID, exp)
+	}
+
+	left := time.Until(exp)
+	l.Debug().Msgf("certificate pack expires on %s", exp)
+	window := time.Duration(a.Config.Checks.RenewBeforeDays) * 24 * time.Hour
+	if window > 0 && left < window {
+		l.Warn().Msgf("certificate pack %s expires in %d days but is still not pending validation",
+			p.Type, int(left.Hours()/24))
+	}
+}
+
+// packsCovering returns the packs of packs covering the hostname d
+func packsCovering(packs []cloudflare.CertificatePack, d string) []cloudflare.CertificatePack {
+	var ret []cloudflare.CertificatePack
+	for _, p := range packs {
+		if p.Covers(d) {
+			ret = append(ret, p)
 		}
+	}
+	return ret
+}
 
-		if a.Config.Metrics.Enabled {
-			subl.Debug().Msg("updating timestamp in last updated metric")
-			a.MetricsServer.SetDomainLastUpdatedMetric(d)
+// txtRecords returns the provider records matching the TXT values grouped by
+// record name, sorted by name
+func txtRecords(m map[string][]string) []providers.Record {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ret []providers.Record
+	for _, name := range names {
+		for _, v := range m[name] {
+			ret = append(ret, providers.Record{Name: name, Value: v})
 		}
-		subl.Info().Msg("domain records update completed")
+	}
+	return ret
+}
 
+// cleanupNames returns the names of the validation records of packs that can
+// be cleaned once none of them is pending anymore. When d is the zone itself,
+// packs holds all the packs of the zone and all their hosts are cleaned.
+// Otherwise, other packs of the zone may still need the records of the hosts
+// shared with packs, so only the ones of d are.
+func cleanupNames(packs []cloudflare.CertificatePack, zone, d string) []string {
+	if zone != d {
+		return []string{cloudflare.ChallengeName(d)}
 	}
 
-	return nil
+	var ret []string
+	seen := make(map[string]bool)
+	for _, p := range packs {
+		for _, h := range p.Hosts {
+			name := cloudflare.ChallengeName(h)
+			if !seen[name] {
+				seen[name] = true
+				ret = append(ret, name)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		ret = append(ret, cloudflare.ChallengeName(d))
+	}
+	return ret
 }
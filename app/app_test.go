@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/govirtuo/cfcr/config"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+func Test_txtRecords(t *testing.T) {
+	got := txtRecords(map[string][]string{
+		"_acme-challenge.www.bar.com": {"c"},
+		"_acme-challenge.bar.com":     {"a", "b"},
+	})
+
+	want := "[_acme-challenge.bar.com a _acme-challenge.bar.com b _acme-challenge.www.bar.com c]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+}
+
+func Test_cleanupNames(t *testing.T) {
+	packs := []cloudflare.CertificatePack{
+		{Hosts: []string{"bar.com", "*.bar.com"}},
+		{Hosts: []string{"bar.com", "www.bar.com"}},
+	}
+	tests := []struct {
+		name  string
+		packs []cloudflare.CertificatePack
+		d     string
+		want  string
+	}{
+		{name: "zone", packs: packs, d: "bar.com", want: "[_acme-challenge.bar.com _acme-challenge.www.bar.com]"},
+		{name: "zone without pack", packs: nil, d: "bar.com", want: "[_acme-challenge.bar.com]"},
+		{name: "subdomain", packs: packs[1:], d: "www.bar.com", want: "[_acme-challenge.www.bar.com]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(cleanupNames(tt.packs, "bar.com", tt.d)); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeProvider records the calls made on it
+type fakeProvider struct {
+	exist bool
+	calls []string
+}
+
+func (f *fakeProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	f.calls = append(f.calls, fmt.Sprintf("create %v", records))
+	return nil
+}
+
+func (f *fakeProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	f.calls = append(f.calls, "clean "+name)
+	return nil
+}
+
+func (f *fakeProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	f.calls = append(f.calls, fmt.Sprintf("check %v", records))
+	return f.exist, nil
+}
+
+func TestApp_runDomain(t *testing.T) {
+	const (
+		active  = `{"id":"1","type":"advanced","hosts":["bar.com","*.bar.com"],"status":"active"}`
+		waiting = `{"id":"2","type":"advanced","hosts":["bar.com","www.bar.com"],"status":"initializing"}`
+		pending = `{"id":"3","type":"advanced","hosts":["bar.com","api.bar.com"],"status":"pending_validation",
+			"validation_records":[{"txt_name":"_acme-challenge.bar.com","txt_value":"abc"},{"txt_name":"_acme-challenge.api.bar.com","txt_value":"def"}]}`
+		blog = `{"id":"4","type":"advanced","hosts":["blog.bar.com"],"status":"pending_validation",
+			"validation_records":[{"txt_name":"_acme-challenge.blog.bar.com","txt_value":"ghi"}]}`
+	)
+	tests := []struct {
+		name        string
+		domain      string
+		packs       []string
+		status      int
+		body        string
+		exist       bool
+		dryRun      bool
+		want        []string
+		wantAuthErr bool
+	}{
+		{
+			name:   "mixed packs",
+			domain: "bar.com",
+			packs:  []string{active, waiting, pending},
+			want: []string{
+				"check [_acme-challenge.api.bar.com def _acme-challenge.bar.com abc]",
+				"create [_acme-challenge.api.bar.com def _acme-challenge.bar.com abc]",
+			},
+		},
+		{
+			name:   "records already set",
+			domain: "bar.com",
+			packs:  []string{active, pending},
+			exist:  true,
+			want:   []string{"check [_acme-challenge.api.bar.com def _acme-challenge.bar.com abc]"},
+		},
+		{
+			name:   "dry run",
+			domain: "bar.com",
+			packs:  []string{active, pending},
+			dryRun: true,
+		},
+		{
+			// the records are kept until the pack being processed is done
+			name:   "waiting pack",
+			domain: "bar.com",
+			packs:  []string{active, waiting},
+		},
+		{
+			name:   "active packs",
+			domain: "bar.com",
+			packs:  []string{active},
+			want:   []string{"clean _acme-challenge.bar.com"},
+		},
+		{
+			// the pending pack of blog.bar.com does not cover the domain
+			name:   "subdomain",
+			domain: "www.bar.com",
+			packs:  []string{active, blog},
+			want:   []string{"clean _acme-challenge.www.bar.com"},
+		},
+		{
+			// the error is returned so that the account is skipped
+			name:        "rejected credentials",
+			domain:      "bar.com",
+			status:      http.StatusUnauthorized,
+			body:        `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`,
+			wantAuthErr: true,
+		},
+		{
+			// Cloudflare answers a wrong API key with a 403
+			name:        "rejected API key",
+			domain:      "bar.com",
+			status:      http.StatusForbidden,
+			body:        `{"success":false,"errors":[{"code":9103,"message":"Unknown X-Auth-Key or X-Auth-Email"}]}`,
+			wantAuthErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+					return
+				}
+				switch {
+				case r.URL.Path == "/zones" && r.URL.Query().Get("name") == "bar.com":
+					fmt.Fprint(w, `{"success":true,"result":[{"id":"zoneid"}]}`)
+				case r.URL.Path == "/zones":
+					fmt.Fprint(w, `{"success":true,"result":[]}`)
+				case r.URL.Path == "/zones/zoneid/ssl/certificate_packs":
+					fmt.Fprintf(w, `{"success":true,"result":[%s]}`, strings.Join(tt.packs, ","))
+				default:
+					t.Errorf("got path '%v'", r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			p := &fakeProvider{exist: tt.exist}
+			a := App{
+				Logger:   zerolog.Nop(),
+				Config:   &config.Config{},
+				Provider: p,
+				Cloudflare: map[string]*cloudflare.Client{
+					config.DefaultAccount: cloudflare.NewClient(cloudflare.Credentials{Token: "token"}).WithBaseURL(srv.URL),
+				},
+			}
+			err := a.runDomain(context.Background(), config.Domain{Name: tt.domain, Account: config.DefaultAccount}, tt.dryRun)
+			if cloudflare.IsAuthError(err) != tt.wantAuthErr || (err != nil && !tt.wantAuthErr) {
+				t.Fatalf("got error '%v', wantAuthErr %v", err, tt.wantAuthErr)
+			}
+			if fmt.Sprint(p.calls) != fmt.Sprint(tt.want) {
+				t.Errorf("got calls '%v', want '%v'", p.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_revalidate(t *testing.T) {
+	var restarted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			t.Errorf("got method '%v', want 'PATCH'", r.Method)
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/zones/zoneid/ssl/certificate_packs/")
+		restarted = append(restarted, id)
+		fmt.Fprintf(w, `{"success":true,"result":{"id":"%s","status":"pending_validation"}}`, id)
+	}))
+	defer srv.Close()
+
+	a := App{Logger: zerolog.Nop(), Config: &config.Config{}}
+	cf := cloudflare.NewClient(cloudflare.Credentials{Token: "token"}).WithBaseURL(srv.URL)
+	// the packs have no validation record, so that no DNS lookup is made
+	packs := []cloudflare.CertificatePack{
+		{ID: "1", Status: cloudflare.StatusPendingValidation},
+		{ID: "2", Status: cloudflare.StatusValidationTimedOut},
+	}
+	a.revalidate(context.Background(), zerolog.Nop(), cf, "zoneid", packs)
+
+	// Cloudflare only accepts a restart for the packs whose validation timed
+	// out
+	if fmt.Sprint(restarted) != "[2]" {
+		t.Errorf("got restarted packs '%v', want '[2]'", restarted)
+	}
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/govirtuo/cfcr/config"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+// statusTracker keeps the last known status of the custom hostnames across
+// runs
+type statusTracker struct {
+	sync.Mutex
+	status map[string]cloudflare.PackStatus
+}
+
+// runCustomHostnames publishes the TXT validation records of the custom
+// hostnames of every configured SaaS zone, for the hostnames whose DNS is
+// managed by the provider. The zones of the accounts in rejected are skipped,
+// and the accounts whose credentials get rejected are added to it.
+func (a App) runCustomHostnames(ctx context.Context, rejected map[string]bool, dryRun bool) {
+	for _, ch := range a.Config.Checks.CustomHostnames {
+		if ctx.Err() != nil {
+			return
+		}
+
+		l := a.Logger.With().Str("zone", ch.Zone).Str("account", ch.AccountName()).Logger()
+		if rejected[ch.AccountName()] {
+			l.Warn().Msg("skipping zone, the credentials of its account are rejected by Cloudflare")
+			continue
+		}
+		if err := a.runCustomHostnamesZone(ctx, l, ch, dryRun); cloudflare.IsAuthError(err) {
+			rejected[ch.AccountName()] = true
+		}
+	}
+}
+
+// runCustomHostnamesZone processes the custom hostnames of the SaaS zone of
+// ch. The whole processing is bounded by the per-domain timeout. The
+// Cloudflare error that prevented the processing, if any, is returned.
+func (a App) runCustomHostnamesZone(ctx context.Context, l zerolog.Logger, ch config.CustomHostnames, dryRun bool) error {
+	ctx, cancel := context.WithTimeout(ctx, a.Config.DomainTimeout())
+	defer cancel()
+
+	cf := a.Cloudflare[ch.AccountName()]
+	zone, err := cf.ResolveZone(ctx, ch.Zone)
+	if err != nil {
+		logCloudflareError(l, err, "cannot resolve zone")
+		return err
+	}
+
+	l.Info().Msg("getting custom hostnames on Cloudflare API")
+	hostnames, err := cf.ListCustomHostnames(ctx, zone.ID)
+	if err != nil {
+		logCloudflareError(l, err, "cannot get custom hostnames")
+		return err
+	}
+
+	for _, h := range hostnames {
+		if !matchAny(ch.Hostnames, h.Hostname) {
+			continue
+		}
+		a.processCustomHostname(ctx, l.With().Str("hostname", h.Hostname).Logger(), h, dryRun)
+	}
+	return nil
+}
+
+// processCustomHostname publishes the TXT validation records of the custom
+// hostname h if its certificate is pending validation, and cleans them once
+// it is active
+func (a App) processCustomHostname(ctx context.Context, l zerolog.Logger, h cloudflare.CustomHostname, dryRun bool) {
+	a.trackCustomHostname(l, h)
+
+	// the ownership record is published with the certificate ones, so that
+	// the hostname gets verified without any manual intervention
+	var ownership []providers.Record
+	if h.Status == "pending" && h.OwnershipVerification.Type == "txt" && h.OwnershipVerification.Name != "" {
+		l.Info().Msg("hostname ownership is not verified yet")
+		ownership = append(ownership, providers.Record{
+			Name:  h.OwnershipVerification.Name,
+			Value: h.OwnershipVerification.Value,
+		})
+	}
+
+	if h.SSL.Method != "" && h.SSL.Method != cloudflare.ValidationTXT {
+		l.Debug().Msgf("certificate is validated with method %s, skipping", h.SSL.Method)
+		a.publishCustomHostnameRecords(ctx, l, h, ownership, dryRun)
+		return
+	}
+
+	switch h.SSL.Status.Action() {
+	case cloudflare.ActionNone:
+		l.Info().Msg("certificate is active, trying to cleanup provider's TXT records")
+		if dryRun {
+			l.Info().Msg("running in dry-mode, stopping actions now")
+			return
+		}
+		if err := a.Provider.CleanTXTRecords(ctx, l, cloudflare.ChallengeName(h.Hostname)); err != nil {
+			l.Error().Err(err).Msg("cannot clean TXT records")
+		}
+		a.publishCustomHostnameRecords(ctx, l, h, ownership, dryRun)
+	case cloudflare.ActionWriteTXT:
+		records := txtRecords(h.TXTRecords())
+		if len(records) == 0 {
+			l.Warn().Msg("certificate is pending but has no TXT validation record")
+		} else {
+			l.Info().Msg("certificate is pending")
+		}
+		a.publishCustomHostnameRecords(ctx, l, h, append(ownership, records...), dryRun)
+	default:
+		l.Info().Msgf("nothing to do while the certificate is '%s'", h.SSL.Status)
+		a.publishCustomHostnameRecords(ctx, l, h, ownership, dryRun)
+	}
+}
+
+// publishCustomHostnameRecords creates the TXT records of the custom hostname
+// h, unless they are already set
+func (a App) publishCustomHostnameRecords(ctx context.Context, l zerolog.Logger, h cloudflare.CustomHostname, records []providers.Record, dryRun bool) {
+	if len(records) == 0 {
+		return
+	}
+	l.Debug().Msgf("got TXT records from Cloudflare: %s", records)
+	if dryRun {
+		l.Info().Msg("running in dry-mode, stopping actions now")
+		return
+	}
+
+	ok, err := a.Provider.CheckIfRecordsAlreadyExist(ctx, l, records...)
+	if err != nil {
+		l.Error().Err(err).Msg("cannot check if TXT records already exist")
+		return
+	}
+	if ok {
+		l.Info().Msg("TXT records are already set but the hostname is still not validated, so no need to pursue")
+		return
+	}
+
+	if err := a.Provider.CreateTXTRecords(ctx, l, records...); err != nil {
+		l.Error().Err(err).Msg("failed to create TXT records")
+		return
+	}
+	if a.Config.Metrics.Enabled {
+		a.MetricsServer.SetDomainLastUpdatedMetric(h.Hostname)
+	}
+	l.Info().Msg("hostname records update completed")
+}
+
+// trackCustomHostname records the SSL status of the custom hostname h and logs
+// its changes
+func (a App) trackCustomHostname(l zerolog.Logger, h cloudflare.CustomHostname) {
+	a.customHostnames.Lock()
+	previous, known := a.customHostnames.status[h.Hostname]
+	a.customHostnames.status[h.Hostname] = h.SSL.Status
+	a.customHostnames.Unlock()
+
+	if previous == h.SSL.Status {
+		return
+	}
+	if known {
+		l.Info().Msgf("certificate status changed from '%s' to '%s'", previous, h.SSL.Status)
+	} else {
+		l.Debug().Msgf("certificate status is '%s'", h.SSL.Status)
+	}
+
+	if a.Config.Metrics.Enabled {
+		a.MetricsServer.SetCustomHostnameStatusMetric(h.Hostname, string(previous), string(h.SSL.Status))
+	}
+}
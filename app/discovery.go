@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/govirtuo/cfcr/config"
+)
+
+// Domains returns the list of domains to watch: the ones listed in the
+// configuration, plus the ones discovered on Cloudflare if the discovery is
+// enabled.
+func (a App) Domains(ctx context.Context) []config.Domain {
+	domains := append([]config.Domain{}, a.Config.Checks.Domains...)
+	if !a.Config.Checks.Discovery.Enabled {
+		return domains
+	}
+
+	seen := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		seen[d.Name] = true
+	}
+
+	for _, d := range a.discoverDomains(ctx) {
+		if seen[d.Name] {
+			continue
+		}
+		seen[d.Name] = true
+		domains = append(domains, d)
+	}
+	return domains
+}
+
+// discoverDomains lists the zones visible to the discovery accounts and
+// returns the hosts of their advanced certificate packs validated with TXT
+// records
+func (a App) discoverDomains(ctx context.Context) []config.Domain {
+	disc := a.Config.Checks.Discovery
+	accounts := disc.Accounts
+	if len(accounts) == 0 {
+		for name := range a.Cloudflare {
+			accounts = append(accounts, name)
+		}
+		sort.Strings(accounts)
+	}
+
+	var ret []config.Domain
+	for _, acc := range accounts {
+		l := a.Logger.With().Str("account", acc).Logger()
+		cf := a.Cloudflare[acc]
+
+		l.Info().Msg("discovering zones on Cloudflare API")
+		zones, err := cf.ListZones(ctx)
+		if err != nil {
+			logCloudflareError(l, err, "cannot list zones")
+			continue
+		}
+
+		for _, z := range zones {
+			if len(disc.Zones) > 0 && !matchAny(disc.Zones, z.Name) {
+				continue
+			}
+			zl := l.With().Str("zone", z.Name).Logger()
+
+			packs, err := cf.GetCertificatePacks(ctx, z.ID)
+			if err == cloudflare.ErrNoResult {
+				zl.Debug().Msg("zone has no certificate pack")
+				continue
+			}
+			if err != nil {
+				logCloudflareError(zl, err, "cannot get certificate packs")
+				if cloudflare.IsAuthError(err) {
+					break
+				}
+				continue
+			}
+
+			for _, h := range discoverHosts(packs) {
+				if len(disc.Include) > 0 && !matchAny(disc.Include, h) {
+					continue
+				}
+				if matchAny(disc.Exclude, h) {
+					continue
+				}
+				zl.Debug().Msgf("discovered domain %s", h)
+				ret = append(ret, config.Domain{Name: h, Account: acc})
+			}
+		}
+	}
+	a.Logger.Info().Msgf("discovered %d domains on Cloudflare", len(ret))
+	return ret
+}
+
+// discoverHosts returns the hosts of the advanced packs of packs that are
+// validated with TXT records, leaving the ones that are dead (deleted, expired,
+// ...). A wildcard host is validated on its parent
+// domain, so the wildcard label is removed.
+func discoverHosts(packs []cloudflare.CertificatePack) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, p := range packs {
+		if p.Type != "advanced" || p.ValidationMethod != cloudflare.ValidationTXT || p.Status.Action() == cloudflare.ActionAlert {
+			continue
+		}
+		for _, h := range p.Hosts {
+			h = strings.TrimPrefix(strings.ToLower(h), "*.")
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
+// matchAny returns true if name matches one of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+)
+
+func Test_discoverHosts(t *testing.T) {
+	packs := []cloudflare.CertificatePack{
+		{Type: "advanced", ValidationMethod: "txt", Status: cloudflare.StatusActive, Hosts: []string{"bar.com", "*.bar.com"}},
+		{Type: "advanced", ValidationMethod: "txt", Status: cloudflare.StatusPendingValidation, Hosts: []string{"www.staging.bar.com"}},
+		{Type: "advanced", ValidationMethod: "http", Status: cloudflare.StatusActive, Hosts: []string{"http.bar.com"}},
+		{Type: "universal", ValidationMethod: "txt", Status: cloudflare.StatusActive, Hosts: []string{"universal.bar.com"}},
+		{Type: "advanced", ValidationMethod: "txt", Status: cloudflare.StatusDeleted, Hosts: []string{"deleted.bar.com"}},
+		{Type: "advanced", ValidationMethod: "txt", Status: cloudflare.StatusPendingValidation, Hosts: []string{"bar.com", "*.dev.bar.com"}},
+	}
+
+	want := "[bar.com www.staging.bar.com dev.bar.com]"
+	got := discoverHosts(packs)
+	if fmt.Sprint(got) != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+
+	// every discovered host must be processed, the hosts below the zone apex
+	// only being processed with the packs covering them
+	for _, h := range got {
+		if len(packsCovering(packs, h)) == 0 {
+			t.Errorf("no pack covers the discovered host %s", h)
+		}
+	}
+}
+
+func Test_matchAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{name: "no pattern", patterns: nil, host: "www.bar.com", want: false},
+		{name: "exact", patterns: []string{"www.bar.com"}, host: "www.bar.com", want: true},
+		{name: "glob", patterns: []string{"foo.com", "*.bar.com"}, host: "www.staging.bar.com", want: true},
+		{name: "no match", patterns: []string{"*.bar.com"}, host: "bar.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAny(tt.patterns, tt.host); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/rs/zerolog"
+)
+
+// splitHTTPPacks separates the packs validated over HTTP from the other ones
+func splitHTTPPacks(packs []cloudflare.CertificatePack) (http, others []cloudflare.CertificatePack) {
+	for _, p := range packs {
+		if p.ValidationMethod == cloudflare.ValidationHTTP {
+			http = append(http, p)
+			continue
+		}
+		others = append(others, p)
+	}
+	return http, others
+}
+
+// processHTTPPacks publishes the HTTP validation tokens of the pending packs
+// validated over HTTP, and removes them once the packs are active
+func (a App) processHTTPPacks(ctx context.Context, l zerolog.Logger, d string, packs []cloudflare.CertificatePack, dryRun bool) {
+	for _, p := range packs {
+		pl := l.With().Str("pack", p.ID).Str("status", string(p.Status)).Logger()
+		if a.Publisher == nil {
+			pl.Warn().Msgf("certificate pack %s is validated over HTTP but no HTTP challenge publisher is configured", p.Type)
+			continue
+		}
+
+		switch p.Status.Action() {
+		case cloudflare.ActionNone:
+			pl.Info().Msgf("certificate pack %s is active, trying to cleanup HTTP validation tokens", p.Type)
+			if dryRun {
+				pl.Info().Msg("running in dry-mode, stopping actions now")
+				continue
+			}
+			for _, h := range p.Hosts {
+				if err := a.Publisher.Clean(ctx, pl, strings.TrimPrefix(h, "*.")); err != nil {
+					pl.Error().Err(err).Msgf("cannot clean HTTP validation tokens of %s", h)
+				}
+			}
+		case cloudflare.ActionWriteTXT:
+			records := p.HTTPRecords()
+			if len(records) == 0 {
+				pl.Warn().Msgf("certificate pack %s is pending but has no HTTP validation record", p.Type)
+				continue
+			}
+			pl.Info().Msgf("certificate pack %s is pending for hosts %s, publishing %d HTTP validation tokens",
+				p.Type, p.Hosts, len(records))
+			if dryRun {
+				pl.Info().Msg("running in dry-mode, stopping actions now")
+				continue
+			}
+
+			var failed bool
+			for u, body := range records {
+				if err := a.Publisher.Publish(ctx, pl, u, body); err != nil {
+					pl.Error().Err(err).Msgf("cannot publish HTTP validation token on %s", u)
+					failed = true
+				}
+			}
+			if !failed && a.Config.Metrics.Enabled {
+				a.MetricsServer.SetDomainLastUpdatedMetric(d)
+			}
+		default:
+			pl.Info().Msgf("certificate pack %s is validated over HTTP, nothing to do in its current status", p.Type)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/govirtuo/cfcr/config"
+	"github.com/govirtuo/cfcr/providers"
+)
+
+// MigrateDCV delegates the validation of every watched domain to Cloudflare:
+// the _acme-challenge TXT records are replaced by a CNAME record pointing at
+// the delegated DCV target of the zone. Domains with a certificate pack
+// pending validation are left untouched, so that an ongoing renewal does not
+// break.
+func (a App) MigrateDCV(ctx context.Context, dryRun bool) error {
+	dp, ok := a.Provider.(providers.DelegationProvider)
+	if !ok {
+		return errors.New("the configured provider cannot create DCV delegation records")
+	}
+
+	// the UUID is the same for all the hostnames of a zone
+	uuids := make(map[string]string)
+	var migrated int
+	domains := a.Domains(ctx)
+	for _, dom := range domains {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if a.migrateDomain(ctx, dp, dom, uuids, dryRun) {
+			migrated++
+		}
+	}
+
+	a.Logger.Info().Msgf("DCV delegation completed for %d out of %d domains", migrated, len(domains))
+	return nil
+}
+
+// migrateDomain delegates the validation of the domain dom to Cloudflare,
+// reading and filling the cache of delegation UUIDs indexed by zone ID. The
+// whole processing is bounded by the per-domain timeout. It returns true if
+// the domain was migrated.
+func (a App) migrateDomain(ctx context.Context, dp providers.DelegationProvider, dom config.Domain, uuids map[string]string, dryRun bool) bool {
+	ctx, cancel := context.WithTimeout(ctx, a.Config.DomainTimeout())
+	defer cancel()
+
+	d := dom.Name
+	subl := a.Logger.With().Str("domain", d).Str("account", dom.Account).Logger()
+	cf := a.Cloudflare[dom.Account]
+
+	zone, err := cf.ResolveZone(ctx, d)
+	if err != nil {
+		logCloudflareError(subl, err, "cannot resolve zone")
+		return false
+	}
+
+	packs, err := cf.GetCertificatePacks(ctx, zone.ID)
+	if err != nil && err != cloudflare.ErrNoResult {
+		logCloudflareError(subl, err, "cannot get certificate packs")
+		return false
+	}
+	if zone.Name != d {
+		packs = packsCovering(packs, d)
+	}
+	if hasPendingPack(packs) {
+		subl.Warn().Msg("a certificate pack is pending validation, migrate this domain once it is active")
+		return false
+	}
+
+	uuid, ok := uuids[zone.ID]
+	if !ok {
+		uuid, err = cf.GetDCVDelegationUUID(ctx, zone.ID)
+		if err != nil {
+			logCloudflareError(subl, err, "cannot get DCV delegation UUID")
+			return false
+		}
+		uuids[zone.ID] = uuid
+	}
+	target := cloudflare.DCVDelegationTarget(d, uuid)
+
+	subl.Info().Msgf("delegating DCV to %s", target)
+	if dryRun {
+		subl.Info().Msg("running in dry-mode, stopping actions now")
+		return false
+	}
+
+	// a CNAME record cannot coexist with other records, so the TXT records
+	// are removed first
+	name := cloudflare.ChallengeName(d)
+	if err := dp.CleanTXTRecords(ctx, subl, name); err != nil {
+		subl.Error().Err(err).Msg("cannot clean TXT records")
+		return false
+	}
+	if err := dp.CreateDelegationRecord(ctx, subl, name, target); err != nil {
+		subl.Error().Err(err).Msg("cannot create DCV delegation record")
+		return false
+	}
+	subl.Info().Msg("DCV delegation completed, this domain can be removed from cfcr configuration")
+	return true
+}
+
+// hasPendingPack returns true if one of packs is waiting for its validation
+// records
+func hasPendingPack(packs []cloudflare.CertificatePack) bool {
+	for _, p := range packs {
+		if a := p.Status.Action(); a == cloudflare.ActionWriteTXT || a == cloudflare.ActionRevalidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/rs/zerolog"
+)
+
+// orderPack orders a new advanced certificate pack for the domain d of zone,
+// with the settings of .checks.ordering. It returns false if no pack was
+// ordered.
+func (a App) orderPack(ctx context.Context, l zerolog.Logger, cf *cloudflare.Client, zone cloudflare.Zone, d string, dryRun bool) (cloudflare.CertificatePack, bool) {
+	o := a.Config.Checks.Ordering.WithDefaults()
+	order := cloudflare.PackOrder{
+		Hosts:                o.HostsFor(zone.Name, d),
+		CertificateAuthority: o.CertificateAuthority,
+		ValidityDays:         o.ValidityDays,
+		ValidationMethod:     o.ValidationMethod,
+	}
+
+	l.Info().Msgf("ordering a new advanced certificate pack from %s for hosts %s", order.CertificateAuthority, order.Hosts)
+	if dryRun {
+		l.Info().Msg("running in dry-mode, stopping actions now")
+		return cloudflare.CertificatePack{}, false
+	}
+
+	p, err := cf.OrderCertificatePack(ctx, zone.ID, order)
+	if err != nil {
+		logCloudflareError(l, err, "cannot order certificate pack")
+		return cloudflare.CertificatePack{}, false
+	}
+	l.Info().Str("pack", p.ID).Msgf("certificate pack ordered, its status is %s", p.Status)
+	return p, true
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CheckCloudflareAccess verifies the credentials of every Cloudflare account,
+// then probes the permissions they have on each watched domain and logs a
+// report of the missing ones. An error is returned if some credentials are not
+// valid or if none of the domains can be processed.
+func (a App) CheckCloudflareAccess(ctx context.Context) error {
+	for name, cf := range a.Cloudflare {
+		a.Logger.Info().Msgf("verifying credentials of Cloudflare account '%s'", name)
+		if err := cf.Verify(ctx); err != nil {
+			return fmt.Errorf("credentials of cloudflare account '%s' are not valid: %w", name, err)
+		}
+	}
+
+	var usable int
+	for _, dom := range a.Config.Checks.Domains {
+		subl := a.Logger.With().Str("domain", dom.Name).Str("account", dom.Account).Logger()
+
+		missing, err := a.Cloudflare[dom.Account].MissingPermissions(ctx, dom.Name)
+		if err != nil {
+			logCloudflareError(subl, err, "cannot check Cloudflare permissions")
+			continue
+		}
+
+		if len(missing) > 0 {
+			subl.Error().Msgf("cloudflare credentials are missing the following permissions on this zone: %s", missing)
+			continue
+		}
+		subl.Debug().Msg("cloudflare credentials have all the required permissions")
+		usable++
+	}
+
+	if len(a.Config.Checks.Domains) > 0 && usable == 0 {
+		return errors.New("cloudflare credentials cannot be used on any of the watched domains")
+	}
+	a.Logger.Info().Msgf("cloudflare credentials can be used on %d out of %d domains",
+		usable, len(a.Config.Checks.Domains))
+	return nil
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/govirtuo/cfcr/cloudflare"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPropagationTimeout = 5 * time.Minute
+	defaultPollInterval       = 30 * time.Second
+)
+
+// revalidate waits for the validation records of packs to be visible in DNS,
+// then asks Cloudflare to validate again the packs whose validation timed out:
+// Cloudflare rejects the call for the other ones, which it checks on its own.
+// If a poll timeout is configured, the packs status is then polled until they
+// are not pending anymore.
+func (a App) revalidate(ctx context.Context, l zerolog.Logger, cf *cloudflare.Client, zoneID string, packs []cloudflare.CertificatePack) {
+	conf := a.Config.Checks.Revalidation
+	propagation := conf.PropagationTimeout
+	if propagation == 0 {
+		propagation = defaultPropagationTimeout
+	}
+	interval := conf.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+
+	for _, p := range packs {
+		pl := l.With().Str("pack", p.ID).Logger()
+
+		pl.Info().Msg("waiting for the validation records to be visible in DNS")
+		if err := waitForTXTRecords(ctx, p.TXTRecords(), propagation, interval); err != nil {
+			pl.Error().Err(err).Msg("validation records are not visible, not triggering the validation")
+			continue
+		}
+
+		if p.Status.Action() == cloudflare.ActionRevalidate {
+			pl.Info().Msg("triggering certificate pack validation on Cloudflare API")
+			np, err := cf.RestartValidation(ctx, zoneID, p.ID)
+			if err != nil {
+				logCloudflareError(pl, err, "cannot trigger certificate pack validation")
+				continue
+			}
+			pl.Debug().Msgf("certificate pack status is now '%s'", np.Status)
+		}
+
+		if conf.PollTimeout == 0 {
+			continue
+		}
+
+		status, err := pollPackStatus(ctx, cf, zoneID, p.ID, conf.PollTimeout, interval)
+		if err != nil {
+			logCloudflareError(pl, err, "cannot poll certificate pack status")
+			continue
+		}
+		if status.Action() == cloudflare.ActionWriteTXT || status.Action() == cloudflare.ActionRevalidate {
+			pl.Warn().Msgf("certificate pack is still '%s' after %s", status, conf.PollTimeout)
+			continue
+		}
+		pl.Info().Msgf("certificate pack moved to '%s'", status)
+	}
+}
+
+// pollPackStatus gets the status of the pack packID every interval until it is
+// not waiting for validation anymore, timeout is reached or ctx is done. The
+// last known status is returned.
+func pollPackStatus(ctx context.Context, cf *cloudflare.Client, zoneID, packID string, timeout, interval time.Duration) (cloudflare.PackStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		p, err := cf.GetCertificatePack(ctx, zoneID, packID)
+		if err != nil {
+			return "", err
+		}
+
+		action := p.Status.Action()
+		if (action != cloudflare.ActionWriteTXT && action != cloudflare.ActionRevalidate) ||
+			time.Now().Add(interval).After(deadline) {
+			return p.Status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return p.Status, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitForTXTRecords resolves every record name of records until all of their
+// values are returned, timeout is reached or ctx is done.
+func waitForTXTRecords(ctx context.Context, records map[string][]string, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for name, values := range records {
+		for {
+			found, err := net.DefaultResolver.LookupTXT(ctx, name)
+			if err == nil && containsAll(found, values) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("TXT records of %s are not visible after %s", name, timeout)
+			case <-time.After(interval):
+			}
+		}
+	}
+	return nil
+}
+
+// containsAll returns true if every element of want is in got
+func containsAll(got, want []string) bool {
+	set := make(map[string]bool, len(got))
+	for _, v := range got {
+		set[v] = true
+	}
+	for _, v := range want {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package awsauth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// example taken from the AWS Signature Version 4 documentation
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	credz := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	Sign(req, nil, credz, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("got X-Amz-Date '%v', want '20150830T123600Z'", got)
+	}
+}
+
+func TestSign_s3(t *testing.T) {
+	req, err := http.NewRequest("PUT", "https://bucket.s3.amazonaws.com/foo/bar.txt", nil)
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	Sign(req, []byte("hello"), Credentials{AccessKeyID: "a", SecretAccessKey: "b", SessionToken: "c"},
+		"eu-west-1", "s3", time.Now())
+
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("got payload hash '%v'", got)
+	}
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "c" {
+		t.Errorf("got security token '%v', want 'c'", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("got '%v'", got)
+	}
+}
@@ -0,0 +1,130 @@
+package azureauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuthority is the Microsoft Entra ID endpoint of the Azure
+	// public cloud
+	DefaultAuthority = "https://login.microsoftonline.com"
+	// DefaultResource is the Azure Resource Manager endpoint of the Azure
+	// public cloud
+	DefaultResource = "https://management.azure.com/"
+
+	// tokens are renewed a bit before they expire so that a request never
+	// carries an expired token
+	expiryMargin = time.Minute
+)
+
+// ClientCredentials are the credentials of an Azure service principal
+type ClientCredentials struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// Authority and Resource only need to be set for sovereign clouds or
+	// tests
+	Authority string
+	Resource  string
+}
+
+// TokenSource gets access tokens for a service principal using the OAuth 2.0
+// client credentials flow. Tokens are cached until they expire, a single
+// TokenSource should be shared by all the requests.
+type TokenSource struct {
+	Credentials ClientCredentials
+	Client      *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewTokenSource creates a TokenSource for credz
+func NewTokenSource(credz ClientCredentials) *TokenSource {
+	return &TokenSource{Credentials: credz}
+}
+
+// Resource returns the resource the tokens are valid for
+func (ts *TokenSource) Resource() string {
+	if ts.Credentials.Resource == "" {
+		return DefaultResource
+	}
+	return ts.Credentials.Resource
+}
+
+// Token returns a valid access token, getting a new one if needed
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Add(expiryMargin).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	authority := ts.Credentials.Authority
+	if authority == "" {
+		authority = DefaultAuthority
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/token", strings.TrimSuffix(authority, "/"), ts.Credentials.TenantID)
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {ts.Credentials.ClientID},
+		"client_secret": {ts.Credentials.ClientSecret},
+		"resource":      {ts.Resource()},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := ts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	now := time.Now()
+	r, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	if r.StatusCode >= 300 {
+		return "", fmt.Errorf("token endpoint returned HTTP %d: %s", r.StatusCode, data)
+	}
+
+	// expires_in is a string on the v1 endpoint
+	var res struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("token endpoint returned no access token")
+	}
+	expiresIn, err := strconv.Atoi(res.ExpiresIn.String())
+	if err != nil {
+		return "", fmt.Errorf("token endpoint returned an invalid expiry: %w", err)
+	}
+
+	ts.token = res.AccessToken
+	ts.expiry = now.Add(time.Duration(expiresIn) * time.Second)
+	return ts.token, nil
+}
@@ -0,0 +1,109 @@
+package azureauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenSource_Token(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn string
+		wantErr   bool
+	}{
+		{name: "v1 endpoint", expiresIn: `"3599"`},
+		{name: "v2 endpoint", expiresIn: `3599`},
+		{name: "invalid expiry", expiresIn: `"soon"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.URL.Path != "/tenant/oauth2/token" {
+					t.Errorf("got path '%v'", r.URL.Path)
+				}
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("cannot parse form: %v", err)
+				}
+				if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "id" ||
+					r.Form.Get("client_secret") != "secret" || r.Form.Get("resource") != DefaultResource {
+					t.Errorf("got form '%v'", r.Form)
+				}
+				fmt.Fprintf(w, `{"access_token":"token","expires_in":%s}`, tt.expiresIn)
+			}))
+			defer srv.Close()
+
+			ts := NewTokenSource(ClientCredentials{
+				TenantID:     "tenant",
+				ClientID:     "id",
+				ClientSecret: "secret",
+				Authority:    srv.URL,
+			})
+			for i := 0; i < 2; i++ {
+				got, err := ts.Token(context.Background())
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("got error '%v', wantErr %v", err, tt.wantErr)
+				}
+				if !tt.wantErr && got != "token" {
+					t.Errorf("got token '%v', want 'token'", got)
+				}
+			}
+			if !tt.wantErr && calls != 1 {
+				t.Errorf("got %d calls to the token endpoint, want 1", calls)
+			}
+		})
+	}
+}
+
+// TestTokenSource_exchange checks the token request and the parsing of the
+// response against the examples of the Microsoft identity platform
+// documentation of the client credentials flow.
+func TestTokenSource_exchange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/72f988bf-86f1-41af-91ab-2d7cd011db47/oauth2/token" {
+			t.Errorf("got '%v %v'", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+			t.Errorf("got content type '%v'", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		want := "client_id=535fb089-9ff3-47b6-9bfb-4f1264799865&client_secret=sampleCredentia1s" +
+			"&grant_type=client_credentials&resource=https%3A%2F%2Fmanagement.azure.com%2F"
+		if string(body) != want {
+			t.Errorf("got body '%s', want '%s'", body, want)
+		}
+		fmt.Fprint(w, `{
+			"token_type": "Bearer",
+			"expires_in": "3599",
+			"ext_expires_in": "3599",
+			"expires_on": "1388444763",
+			"not_before": "1388440863",
+			"resource": "https://management.azure.com/",
+			"access_token": "eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzI1NiIsIng1dCI6Ik1uQ19WWmNBVGZNNXBP"
+		}`)
+	}))
+	defer srv.Close()
+
+	ts := NewTokenSource(ClientCredentials{
+		TenantID:     "72f988bf-86f1-41af-91ab-2d7cd011db47",
+		ClientID:     "535fb089-9ff3-47b6-9bfb-4f1264799865",
+		ClientSecret: "sampleCredentia1s",
+		Authority:    srv.URL,
+	})
+	got, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if got != "eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzI1NiIsIng1dCI6Ik1uQ19WWmNBVGZNNXBP" {
+		t.Errorf("got token '%v'", got)
+	}
+	if left := time.Until(ts.expiry); left < 3590*time.Second || left > 3599*time.Second {
+		t.Errorf("got token valid for %s, want about 3599s", left)
+	}
+}
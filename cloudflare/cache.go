@@ -0,0 +1,129 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultZoneTTL is how long a resolved zone is kept in cache
+	DefaultZoneTTL = 24 * time.Hour
+	// DefaultPackTTL is how long the certificate packs of a zone are kept in
+	// cache. It is kept short since the packs status is what cfcr watches.
+	DefaultPackTTL = time.Minute
+)
+
+// Cache is an in-memory cache whose entries expire after a given duration.
+// It can be persisted to a file so that it survives restarts.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+// NewCache creates a Cache. If path is not empty, the cache is loaded from
+// this file if it exists, and Save writes the cache in it.
+func NewCache(path string) (*Cache, error) {
+	c := Cache{
+		path:    path,
+		entries: make(map[string]cacheEntry),
+	}
+	if path == "" {
+		return &c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// get decodes the value stored under key in v. It returns false if there is
+// no such value or if it expired.
+func (c *Cache) get(key string, v interface{}) bool {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || time.Now().After(e.Expires) {
+		return false
+	}
+	return json.Unmarshal(e.Value, v) == nil
+}
+
+// set stores v under key for ttl. Nothing is stored if ttl is not positive.
+func (c *Cache) set(key string, v interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{Value: data, Expires: time.Now().Add(ttl)}
+}
+
+// delete removes the value stored under key
+func (c *Cache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Save writes the entries that have not expired yet in the cache file. It does
+// nothing if the cache has no file.
+func (c *Cache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.Expires) {
+			delete(c.entries, k)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the file is replaced atomically so that a crash does not leave a
+	// truncated cache behind
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
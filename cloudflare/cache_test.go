@@ -0,0 +1,44 @@
+package cloudflare
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c, err := NewCache(path)
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	c.set("zone:bar.com", Zone{ID: "zoneid", Name: "bar.com"}, time.Hour)
+	c.set("expired", "foo", time.Nanosecond)
+	c.set("disabled", "foo", -1)
+	time.Sleep(time.Millisecond)
+
+	var s string
+	if c.get("expired", &s) {
+		t.Errorf("expired entry should not be returned")
+	}
+	if c.get("disabled", &s) {
+		t.Errorf("entry with a negative TTL should not be stored")
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	loaded, err := NewCache(path)
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	var z Zone
+	if !loaded.get("zone:bar.com", &z) || z.ID != "zoneid" {
+		t.Errorf("got zone '%v' from persisted cache, want '{zoneid bar.com}'", z)
+	}
+	if len(loaded.entries) != 1 {
+		t.Errorf("got %d entries in persisted cache, want 1", len(loaded.entries))
+	}
+}
@@ -0,0 +1,320 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultBaseURL is the root of the Cloudflare v4 API
+	DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+	// DefaultTimeout is the maximum duration of a single request to the API
+	DefaultTimeout = 30 * time.Second
+	// DefaultUserAgent is sent with every request if none is configured
+	DefaultUserAgent = "cfcr"
+	// DefaultPerPage is the number of results requested per page on list
+	// endpoints
+	DefaultPerPage = 50
+)
+
+// Client is a Cloudflare API client. A single Client should be created and
+// reused so that connections are shared across calls.
+type Client struct {
+	Credentials Credentials
+	// AccountID restricts the zone lookups to the zones of this account, if set
+	AccountID string
+	BaseURL   string
+	UserAgent string
+	PerPage   int
+	Retry     RetryPolicy
+
+	httpClient *http.Client
+	limiter    *rate.Limiter
+	// callTimeout bounds a whole call, retries and rate limiting included
+	callTimeout time.Duration
+
+	cache   *Cache
+	zoneTTL time.Duration
+	packTTL time.Duration
+}
+
+// NewClient creates a Client with the default base URL, timeout and user agent.
+// Those can be overridden with the With* methods.
+func NewClient(credz Credentials) *Client {
+	return &Client{
+		Credentials: credz,
+		BaseURL:     DefaultBaseURL,
+		UserAgent:   DefaultUserAgent,
+		PerPage:     DefaultPerPage,
+		Retry:       DefaultRetryPolicy,
+		httpClient: &http.Client{
+			Timeout:   DefaultTimeout,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
+		limiter: rate.NewLimiter(DefaultRequestsPerSecond, DefaultBurst),
+		cache:   &Cache{entries: make(map[string]cacheEntry)},
+		zoneTTL: DefaultZoneTTL,
+		packTTL: DefaultPackTTL,
+	}
+}
+
+// WithBaseURL sets the root URL of the API. It is useful to point the client at
+// a proxy, a recording gateway or a test server.
+func (c *Client) WithBaseURL(u string) *Client {
+	if u != "" {
+		c.BaseURL = strings.TrimSuffix(u, "/")
+	}
+	return c
+}
+
+// WithAccountID restricts the zone lookups to the zones of the account id.
+func (c *Client) WithAccountID(id string) *Client {
+	c.AccountID = id
+	return c
+}
+
+// WithTimeout sets the maximum duration of a single request.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	if d > 0 {
+		c.httpClient.Timeout = d
+	}
+	return c
+}
+
+// WithCallTimeout sets the maximum duration of a call, retries and waits for
+// the rate limiter included. Calls are only bounded by their context if d is
+// not positive.
+func (c *Client) WithCallTimeout(d time.Duration) *Client {
+	c.callTimeout = d
+	return c
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func (c *Client) WithUserAgent(ua string) *Client {
+	if ua != "" {
+		c.UserAgent = ua
+	}
+	return c
+}
+
+// WithPerPage sets the number of results requested per page on list endpoints.
+func (c *Client) WithPerPage(n int) *Client {
+	if n > 0 {
+		c.PerPage = n
+	}
+	return c
+}
+
+// WithRetryPolicy replaces the policy used to retry the failed requests. The
+// zero fields of p are left to their current value.
+func (c *Client) WithRetryPolicy(p RetryPolicy) *Client {
+	if p.MaxAttempts > 0 {
+		c.Retry.MaxAttempts = p.MaxAttempts
+	}
+	if p.MinBackoff > 0 {
+		c.Retry.MinBackoff = p.MinBackoff
+	}
+	if p.MaxBackoff > 0 {
+		c.Retry.MaxBackoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		c.Retry.Jitter = p.Jitter
+	}
+	return c
+}
+
+// WithRateLimit limits the number of requests sent per second, allowing bursts
+// of burst requests.
+func (c *Client) WithRateLimit(rps float64, burst int) *Client {
+	if rps > 0 {
+		c.limiter.SetLimit(rate.Limit(rps))
+	}
+	if burst > 0 {
+		c.limiter.SetBurst(burst)
+	}
+	return c
+}
+
+// WithCache replaces the cache used to store resolved zones and certificate
+// packs, and sets how long they are kept. A zero TTL keeps the current one, a
+// negative TTL disables the caching.
+func (c *Client) WithCache(cache *Cache, zoneTTL, packTTL time.Duration) *Client {
+	if cache != nil {
+		c.cache = cache
+	}
+	if zoneTTL != 0 {
+		c.zoneTTL = zoneTTL
+	}
+	if packTTL != 0 {
+		c.packTTL = packTTL
+	}
+	return c
+}
+
+// WithTransport replaces the transport used to send the requests.
+func (c *Client) WithTransport(t http.RoundTripper) *Client {
+	if t != nil {
+		c.httpClient.Transport = t
+	}
+	return c
+}
+
+// get sends an authenticated GET request on path and decodes the JSON body in v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	return c.do(ctx, "GET", path, nil, v)
+}
+
+// do sends an authenticated request on path with body encoded in JSON, if not
+// nil, and decodes the JSON response in v. Transient errors are retried
+// according to the client retry policy. The whole call, retries included, is
+// bounded by the client call timeout.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	if c.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.callTimeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		// a POST is only sent again when rate limited, since Cloudflare did
+		// not process it: if it failed after being processed, sending it
+		// again would duplicate its effect, such as ordering a second
+		// certificate pack
+		err = c.send(ctx, method, path, payload, v)
+		if err == nil || !isRetryable(err) || attempt >= c.Retry.MaxAttempts {
+			return err
+		}
+		if method == http.MethodPost && !IsRateLimited(err) {
+			return err
+		}
+
+		// there is no point in waiting beyond the deadline, the attempt
+		// would not be sent anyway
+		wait := c.Retry.backoff(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// send sends a single authenticated request on path and decodes the JSON body
+// in v
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, v interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header = http.Header{
+		"Content-Type": {"application/json"},
+		"User-Agent":   {c.UserAgent},
+	}
+	c.Credentials.setHeaders(req)
+
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	// the body of an error may not be JSON at all (e.g. an HTML page sent by
+	// a proxy), so the envelope is only parsed on a best-effort basis
+	var env envelope
+	_ = json.Unmarshal(data, &env)
+	if r.StatusCode >= 300 || (!env.Success && len(env.Errors) > 0) {
+		return &APIError{
+			StatusCode: r.StatusCode,
+			RetryAfter: parseRetryAfter(r),
+			Errors:     env.Errors,
+			Messages:   env.Messages,
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// resultInfo is the pagination block returned by the list endpoints
+type resultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+}
+
+// list walks through all the pages of the list endpoint path and returns the
+// results of every page. The query parameters in params are sent with each page
+// request.
+func list[T any](ctx context.Context, c *Client, path string, params url.Values) ([]T, error) {
+	type APISchema struct {
+		Result     []T        `json:"result"`
+		ResultInfo resultInfo `json:"result_info"`
+	}
+
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("per_page", strconv.Itoa(c.PerPage))
+
+	var ret []T
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+
+		var holder APISchema
+		if err := c.get(ctx, path+"?"+q.Encode(), &holder); err != nil {
+			return nil, err
+		}
+
+		if holder.Result == nil {
+			return nil, ErrEmptyResponse
+		}
+		ret = append(ret, holder.Result...)
+
+		// some endpoints do not paginate and do not return total_pages at all
+		if len(holder.Result) == 0 || page >= holder.ResultInfo.TotalPages {
+			break
+		}
+	}
+	return ret, nil
+}
@@ -1,16 +1,19 @@
 package cloudflare
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// Validation methods of a certificate pack
 const (
-	PendingCertificate = "pending_validation"
-	ActiveCertificate  = "active"
+	ValidationTXT  = "txt"
+	ValidationHTTP = "http"
 )
 
 var (
@@ -18,160 +21,209 @@ var (
 	ErrNoResult      = errors.New("cloudflare did not return any result in the response")
 )
 
+// Credentials used to authenticate against Cloudflare API. Either Token, or
+// both Email and APIKey for the legacy Global API Key scheme, must be set.
 type Credentials struct {
-	Token string
+	Token  string
+	Email  string
+	APIKey string
+}
+
+// setHeaders sets the authentication headers of req, depending on the scheme
+// the credentials are using
+func (c Credentials) setHeaders(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		return
+	}
+	req.Header.Set("X-Auth-Email", c.Email)
+	req.Header.Set("X-Auth-Key", c.APIKey)
+}
+
+// CertificatePack is a certificate pack as returned by Cloudflare API
+type CertificatePack struct {
+	ID                string              `json:"id"`
+	Type              string              `json:"type"`
+	Hosts             []string            `json:"hosts"`
+	Status            PackStatus          `json:"status"`
+	ValidationMethod  string              `json:"validation_method"`
+	ValidityDays      int                 `json:"validity_days"`
+	ValidationRecords []ValidationRecords `json:"validation_records,omitempty"`
+	Certificates      []Certificate       `json:"certificates,omitempty"`
+}
+
+// Certificate is one of the certificates of a certificate pack
+type Certificate struct {
+	ID        string    `json:"id"`
+	Hosts     []string  `json:"hosts"`
+	Issuer    string    `json:"issuer"`
+	Status    string    `json:"status"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+// ExpiresOn returns the expiry date of the certificate of the pack that
+// expires first. The zero time is returned if the pack has no certificate.
+func (p CertificatePack) ExpiresOn() time.Time {
+	var ret time.Time
+	for _, c := range p.Certificates {
+		if c.ExpiresOn.IsZero() {
+			continue
+		}
+		if ret.IsZero() || c.ExpiresOn.Before(ret) {
+			ret = c.ExpiresOn
+		}
+	}
+	return ret
+}
+
+// TXTRecords returns the TXT values Cloudflare expects for this pack, grouped
+// by record name
+func (p CertificatePack) TXTRecords() map[string][]string {
+	ret := make(map[string][]string)
+	for _, v := range p.ValidationRecords {
+		if v.TxtName != "" && v.TxtValue != "" {
+			ret[v.TxtName] = append(ret[v.TxtName], v.TxtValue)
+		}
+	}
+	return ret
+}
+
+// HTTPRecords returns the HTTP validation records of the pack: the body
+// Cloudflare expects to find at each URL
+func (p CertificatePack) HTTPRecords() map[string]string {
+	ret := make(map[string]string)
+	for _, v := range p.ValidationRecords {
+		if v.HTTPURL != "" {
+			ret[v.HTTPURL] = v.HTTPBody
+		}
+	}
+	return ret
 }
 
 type ValidationRecords struct {
 	Status   string `json:"status"`
 	TxtName  string `json:"txt_name"`
 	TxtValue string `json:"txt_value"`
+	HTTPURL  string `json:"http_url"`
+	HTTPBody string `json:"http_body"`
 }
 
 // GetZoneID takes a zone name and returns the associated zone ID
-func GetZoneID(name string, credz Credentials) (string, error) {
-	type APISchema struct {
-		Result []struct {
-			ID string `json:"id"`
-		} `json:"result"`
-	}
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", name)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header = http.Header{
-		"Authorization": {"Bearer " + credz.Token},
-		"Content-Type":  {"application/json"},
+func (c *Client) GetZoneID(ctx context.Context, name string) (string, error) {
+	type zone struct {
+		ID string `json:"id"`
 	}
 
-	client := &http.Client{}
-	r, err := client.Do(req)
-	if err != nil {
-		return "", err
+	params := url.Values{"name": {name}}
+	if c.AccountID != "" {
+		params.Set("account.id", c.AccountID)
 	}
-	defer r.Body.Close()
 
-	data, err := io.ReadAll(r.Body)
+	zones, err := list[zone](ctx, c, "/zones", params)
 	if err != nil {
 		return "", err
 	}
 
-	var holder APISchema
-	if err := json.Unmarshal(data, &holder); err != nil {
-		return "", err
-	}
-
-	if holder.Result == nil {
-		return "", ErrEmptyResponse
-	}
-
-	if len(holder.Result) < 1 {
+	if len(zones) < 1 {
 		return "", ErrNoResult
 	}
 
-	return holder.Result[0].ID, nil
+	return zones[0].ID, nil
 }
 
-// GetTXTValues requests Cloudflare API to get the validation records
-func GetTXTValues(id string, credz Credentials) ([]ValidationRecords, error) {
-	type APISchema struct {
-		Result []struct {
-			ValidationRecords []ValidationRecords `json:"validation_records,omitempty"`
-		} `json:"result"`
+// GetCertificatePacks returns all the certificate packs of the zone id,
+// whatever their status. The packs are cached for a short time so that the
+// hostnames sharing a zone do not fetch them again.
+func (c *Client) GetCertificatePacks(ctx context.Context, id string) ([]CertificatePack, error) {
+	var packs []CertificatePack
+	if c.cache.get(packsCacheKey(id), &packs) {
+		return packs, nil
 	}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/ssl/certificate_packs?status=all", id)
-	req, err := http.NewRequest("GET", url, nil)
+	path := fmt.Sprintf("/zones/%s/ssl/certificate_packs", id)
+	packs, err := list[CertificatePack](ctx, c, path, url.Values{"status": {"all"}})
 	if err != nil {
-		return []ValidationRecords{}, err
+		return nil, err
 	}
 
-	req.Header = http.Header{
-		"Authorization": {"Bearer " + credz.Token},
-		"Content-Type":  {"application/json"},
+	if len(packs) < 1 {
+		return nil, ErrNoResult
 	}
 
-	client := &http.Client{}
-	r, err := client.Do(req)
-	if err != nil {
-		return []ValidationRecords{}, err
-	}
-	defer r.Body.Close()
+	c.cache.set(packsCacheKey(id), packs, c.packTTL)
+	return packs, nil
+}
 
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		return []ValidationRecords{}, err
-	}
+func packsCacheKey(id string) string {
+	return "packs:" + id
+}
 
-	var holder APISchema
-	if err := json.Unmarshal(data, &holder); err != nil {
-		return []ValidationRecords{}, err
+// GetCertificatePack returns the certificate pack packID of the zone id
+func (c *Client) GetCertificatePack(ctx context.Context, id, packID string) (CertificatePack, error) {
+	type APISchema struct {
+		Result CertificatePack `json:"result"`
 	}
 
-	if holder.Result == nil {
-		return []ValidationRecords{}, ErrEmptyResponse
+	var holder APISchema
+	path := fmt.Sprintf("/zones/%s/ssl/certificate_packs/%s", id, packID)
+	if err := c.get(ctx, path, &holder); err != nil {
+		return CertificatePack{}, err
 	}
 
-	if len(holder.Result) < 1 {
-		return []ValidationRecords{}, ErrNoResult
+	if holder.Result.ID == "" {
+		return CertificatePack{}, ErrEmptyResponse
 	}
 
-	return holder.Result[0].ValidationRecords, nil
+	return holder.Result, nil
 }
 
-func GetCertificatePacksStatus(id string, credz Credentials) (string, error) {
+// RestartValidation asks Cloudflare to check again the validation records of
+// the certificate pack packID of the zone id
+func (c *Client) RestartValidation(ctx context.Context, id, packID string) (CertificatePack, error) {
 	type APISchema struct {
-		Result []struct {
-			Status string `json:"status,omitempty"`
-		} `json:"result"`
-	}
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/ssl/certificate_packs?status=all", id)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+		Result CertificatePack `json:"result"`
 	}
 
-	req.Header = http.Header{
-		"Authorization": {"Bearer " + credz.Token},
-		"Content-Type":  {"application/json"},
+	var holder APISchema
+	path := fmt.Sprintf("/zones/%s/ssl/certificate_packs/%s", id, packID)
+	if err := c.do(ctx, "PATCH", path, struct{}{}, &holder); err != nil {
+		return CertificatePack{}, err
 	}
+	c.cache.delete(packsCacheKey(id))
 
-	client := &http.Client{}
-	r, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer r.Body.Close()
+	return holder.Result, nil
+}
 
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		return "", err
+// GetDCVDelegationUUID returns the UUID of the zone id used to build the
+// targets of the DCV delegation records
+func (c *Client) GetDCVDelegationUUID(ctx context.Context, id string) (string, error) {
+	type APISchema struct {
+		Result struct {
+			UUID string `json:"uuid"`
+		} `json:"result"`
 	}
 
 	var holder APISchema
-	if err := json.Unmarshal(data, &holder); err != nil {
+	if err := c.get(ctx, fmt.Sprintf("/zones/%s/dcv_delegation/uuid", id), &holder); err != nil {
 		return "", err
 	}
 
-	if holder.Result == nil {
+	if holder.Result.UUID == "" {
 		return "", ErrEmptyResponse
 	}
 
-	if len(holder.Result) < 1 {
-		return "", ErrNoResult
-	}
+	return holder.Result.UUID, nil
+}
 
-	switch holder.Result[0].Status {
-	case "active":
-		return ActiveCertificate, nil
-	case "pending_validation":
-		return PendingCertificate, nil
-	default:
-		return "", fmt.Errorf("error while getting the certificate packs status: status '%s' is unknown",
-			holder.Result[0].Status)
-	}
+// ChallengeName returns the name of the record validating hostname. Cloudflare
+// only returns it while a pack is pending, this is used to find the records
+// to clean once the pack is active.
+func ChallengeName(hostname string) string {
+	return "_acme-challenge." + strings.TrimPrefix(hostname, "*.")
+}
+
+// DCVDelegationTarget returns the target of the _acme-challenge CNAME record
+// of hostname delegating its validation to Cloudflare
+func DCVDelegationTarget(hostname, uuid string) string {
+	return fmt.Sprintf("%s.%s.dcv.cloudflare.com", strings.TrimPrefix(hostname, "*."), uuid)
 }
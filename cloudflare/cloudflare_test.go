@@ -0,0 +1,757 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClient_GetZoneID(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "found",
+			body: `{"result":[{"id":"abcdef"}]}`,
+			want: "abcdef",
+		},
+		{
+			name:    "no result",
+			body:    `{"result":[]}`,
+			wantErr: ErrNoResult,
+		},
+		{
+			name:    "empty",
+			body:    `{}`,
+			wantErr: ErrEmptyResponse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer token" {
+					t.Errorf("got Authorization header '%v', want '%v'", got, "Bearer token")
+				}
+				if got := r.Header.Get("User-Agent"); got != "cfcr-test" {
+					t.Errorf("got User-Agent header '%v', want '%v'", got, "cfcr-test")
+				}
+				if got := r.URL.Query().Get("name"); got != "foobar.com" {
+					t.Errorf("got name '%v', want '%v'", got, "foobar.com")
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			c := NewClient(Credentials{Token: "token"}).
+				WithBaseURL(srv.URL).
+				WithUserAgent("cfcr-test")
+			got, err := c.GetZoneID(context.Background(), "foobar.com")
+			if err != tt.wantErr {
+				t.Fatalf("got error '%v', want '%v'", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetCertificatePacks(t *testing.T) {
+	body := `{"result":[
+		{"id":"1","type":"advanced","hosts":["foobar.com"],"status":"active","validation_method":"txt"},
+		{"id":"2","type":"advanced","hosts":["*.foobar.com"],"status":"pending_validation","validation_method":"txt",
+		 "validation_records":[{"txt_name":"_acme-challenge.foobar.com","txt_value":"abc"},{"txt_name":"_acme-challenge.foobar.com","txt_value":"def"}]}
+	]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zoneid/ssl/certificate_packs" {
+			t.Errorf("got path '%v'", r.URL.Path)
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	packs, err := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).GetCertificatePacks(context.Background(), "zoneid")
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(packs) != 2 {
+		t.Fatalf("got %d packs, want 2", len(packs))
+	}
+	if packs[0].Status.Action() != ActionNone {
+		t.Errorf("pack 1 should be active, got status '%v'", packs[0].Status)
+	}
+	if packs[1].Status.Action() != ActionWriteTXT {
+		t.Errorf("pack 2 should be pending, got status '%v'", packs[1].Status)
+	}
+	if got := fmt.Sprint(packs[1].TXTRecords()); got != "map[_acme-challenge.foobar.com:[abc def]]" {
+		t.Errorf("got TXT records '%v', want 'map[_acme-challenge.foobar.com:[abc def]]'", got)
+	}
+}
+
+func Test_list(t *testing.T) {
+	pages := map[string]string{
+		"1": `{"result":[{"id":"a"},{"id":"b"}],"result_info":{"page":1,"per_page":2,"total_pages":2}}`,
+		"2": `{"result":[{"id":"c"}],"result_info":{"page":2,"per_page":2,"total_pages":2}}`,
+	}
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if got := r.URL.Query().Get("per_page"); got != "2" {
+			t.Errorf("got per_page '%v', want '2'", got)
+		}
+		if got := r.URL.Query().Get("status"); got != "all" {
+			t.Errorf("got status '%v', want 'all'", got)
+		}
+		fmt.Fprint(w, pages[r.URL.Query().Get("page")])
+	}))
+	defer srv.Close()
+
+	type item struct {
+		ID string `json:"id"`
+	}
+	c := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).WithPerPage(2)
+	got, err := list[item](context.Background(), c, "/items", url.Values{"status": {"all"}})
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want 2", calls)
+	}
+	if len(got) != 3 || got[0].ID != "a" || got[2].ID != "c" {
+		t.Errorf("got '%v', want '[{a} {b} {c}]'", got)
+	}
+}
+
+func TestClient_get_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		auth       bool
+		permission bool
+		rateLimit  bool
+		server     bool
+	}{
+		{
+			name:   "invalid token",
+			status: http.StatusBadRequest,
+			body:   `{"success":false,"errors":[{"code":6003,"message":"Invalid request headers"}],"messages":[],"result":null}`,
+			auth:   true,
+		},
+		{
+			name:   "missing token",
+			status: http.StatusUnauthorized,
+			body:   `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`,
+			auth:   true,
+		},
+		{
+			name:   "invalid API key",
+			status: http.StatusForbidden,
+			body:   `{"success":false,"errors":[{"code":9103,"message":"Unknown X-Auth-Key or X-Auth-Email"}]}`,
+			auth:   true,
+		},
+		{
+			name:       "missing permission",
+			status:     http.StatusForbidden,
+			body:       `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`,
+			permission: true,
+		},
+		{
+			name:       "missing permission on the resource",
+			status:     http.StatusForbidden,
+			body:       `{"success":false,"errors":[{"code":9109,"message":"Unauthorized to access requested resource"}]}`,
+			permission: true,
+		},
+		{
+			name:      "rate limited",
+			status:    http.StatusTooManyRequests,
+			body:      `{"success":false,"errors":[{"code":971,"message":"Please wait and consider throttling your request speed"}]}`,
+			rateLimit: true,
+		},
+		{
+			name:   "server error with HTML body",
+			status: http.StatusBadGateway,
+			body:   `<html>bad gateway</html>`,
+			server: true,
+		},
+		{
+			name:   "unsuccessful with a 200",
+			status: http.StatusOK,
+			body:   `{"success":false,"errors":[{"code":7000,"message":"oops"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			c := NewClient(Credentials{Token: "token"}).
+				WithBaseURL(srv.URL).
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1})
+			_, err := c.GetZoneID(context.Background(), "foobar.com")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got error '%v', want an APIError", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("got status %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if got := IsAuthError(err); got != tt.auth {
+				t.Errorf("IsAuthError() = %v, want %v", got, tt.auth)
+			}
+			if got := IsPermissionError(err); got != tt.permission {
+				t.Errorf("IsPermissionError() = %v, want %v", got, tt.permission)
+			}
+			if got := IsRateLimited(err); got != tt.rateLimit {
+				t.Errorf("IsRateLimited() = %v, want %v", got, tt.rateLimit)
+			}
+			if got := IsServerError(err); got != tt.server {
+				t.Errorf("IsServerError() = %v, want %v", got, tt.server)
+			}
+		})
+	}
+}
+
+func TestClient_get_retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		retryAfter string
+		attempts   int
+		timeout    time.Duration
+		wantCalls  int
+		wantWait   time.Duration
+		wantErr    bool
+	}{
+		{name: "server error then success", failures: 2, status: http.StatusServiceUnavailable, attempts: 4, wantCalls: 3},
+		{name: "rate limited then success", failures: 1, status: http.StatusTooManyRequests, attempts: 4, wantCalls: 2},
+		{name: "too many failures", failures: 5, status: http.StatusBadGateway, attempts: 3, wantCalls: 3, wantErr: true},
+		{name: "not retryable", failures: 1, status: http.StatusForbidden, attempts: 4, wantCalls: 1, wantErr: true},
+		{
+			name:       "retry after beyond max backoff",
+			failures:   1,
+			status:     http.StatusTooManyRequests,
+			retryAfter: "1",
+			attempts:   4,
+			wantCalls:  2,
+			wantWait:   time.Second,
+		},
+		{
+			name:       "retry after beyond deadline",
+			failures:   1,
+			status:     http.StatusTooManyRequests,
+			retryAfter: "60",
+			attempts:   4,
+			timeout:    time.Second,
+			wantCalls:  1,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"success":true,"result":[{"id":"abcdef"}]}`)
+			}))
+			defer srv.Close()
+
+			c := NewClient(Credentials{Token: "token"}).
+				WithBaseURL(srv.URL).
+				WithRateLimit(1000, 10).
+				WithRetryPolicy(RetryPolicy{
+					MaxAttempts: tt.attempts,
+					MinBackoff:  time.Millisecond,
+					MaxBackoff:  5 * time.Millisecond,
+				}).
+				WithCallTimeout(tt.timeout)
+			start := time.Now()
+			_, err := c.GetZoneID(context.Background(), "foobar.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error '%v', wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantWait {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{name: "first retry", attempt: 1, want: time.Second},
+		{name: "third retry", attempt: 3, want: 4 * time.Second},
+		{name: "capped", attempt: 10, want: 10 * time.Second},
+		{name: "retry after", attempt: 1, err: &APIError{RetryAfter: 7 * time.Second}, want: 7 * time.Second},
+		{name: "retry after not capped", attempt: 1, err: &APIError{RetryAfter: time.Minute}, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.backoff(tt.attempt, tt.err); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackStatus_Action(t *testing.T) {
+	tests := []struct {
+		status PackStatus
+		want   Action
+	}{
+		{status: StatusActive, want: ActionNone},
+		{status: StatusInitializing, want: ActionWait},
+		{status: StatusPendingIssuance, want: ActionWait},
+		{status: StatusPendingDeployment, want: ActionWait},
+		{status: StatusPendingValidation, want: ActionWriteTXT},
+		{status: StatusValidationTimedOut, want: ActionRevalidate},
+		{status: StatusExpired, want: ActionAlert},
+		{status: StatusDeleted, want: ActionAlert},
+		{status: "foobar", want: ActionUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.Action(); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_RestartValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			t.Errorf("got method '%v', want 'PATCH'", r.Method)
+		}
+		if r.URL.Path != "/zones/zoneid/ssl/certificate_packs/packid" {
+			t.Errorf("got path '%v'", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"success":true,"result":{"id":"packid","status":"pending_validation"}}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).RestartValidation(context.Background(), "zoneid", "packid")
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if p.Status != StatusPendingValidation {
+		t.Errorf("got status '%v', want '%v'", p.Status, StatusPendingValidation)
+	}
+}
+
+func TestCertificatePack_ExpiresOn(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		pack CertificatePack
+		want time.Time
+	}{
+		{name: "no certificate", pack: CertificatePack{}, want: time.Time{}},
+		{
+			name: "first to expire",
+			pack: CertificatePack{Certificates: []Certificate{{ExpiresOn: second}, {ExpiresOn: first}, {}}},
+			want: first,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pack.ExpiresOn(); !got.Equal(tt.want) {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentials_setHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		credz Credentials
+		want  map[string]string
+	}{
+		{
+			name:  "token",
+			credz: Credentials{Token: "token"},
+			want:  map[string]string{"Authorization": "Bearer token", "X-Auth-Email": "", "X-Auth-Key": ""},
+		},
+		{
+			name:  "global API key",
+			credz: Credentials{Email: "foo@bar.com", APIKey: "key"},
+			want:  map[string]string{"Authorization": "", "X-Auth-Email": "foo@bar.com", "X-Auth-Key": "key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			tt.credz.setHeaders(req)
+			for k, v := range tt.want {
+				if got := req.Header.Get(k); got != v {
+					t.Errorf("got header %s '%v', want '%v'", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_MissingPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		zones     string
+		packs     int
+		packsBody string
+		want      []Permission
+		wantErr   bool
+	}{
+		{name: "all permissions", zones: `{"result":[{"id":"zoneid"}]}`, packs: http.StatusOK, want: nil},
+		{name: "zone not readable", zones: `{"result":[]}`, want: []Permission{PermissionZoneRead, PermissionSSLRead}},
+		{name: "ssl not readable", zones: `{"result":[{"id":"zoneid"}]}`, packs: http.StatusForbidden, want: []Permission{PermissionSSLRead}},
+		{
+			name:      "ssl not readable with Cloudflare error",
+			zones:     `{"result":[{"id":"zoneid"}]}`,
+			packs:     http.StatusForbidden,
+			packsBody: `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}],"messages":[],"result":null}`,
+			want:      []Permission{PermissionSSLRead},
+		},
+		{
+			name:      "invalid token",
+			zones:     `{"result":[{"id":"zoneid"}]}`,
+			packs:     http.StatusBadRequest,
+			packsBody: `{"success":false,"errors":[{"code":6003,"message":"Invalid request headers"}],"messages":[],"result":null}`,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid API key",
+			zones:     `{"result":[{"id":"zoneid"}]}`,
+			packs:     http.StatusForbidden,
+			packsBody: `{"success":false,"errors":[{"code":9103,"message":"Unknown X-Auth-Key or X-Auth-Email"}],"messages":[],"result":null}`,
+			wantErr:   true,
+		},
+		{name: "server error", zones: `{"result":[{"id":"zoneid"}]}`, packs: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/zones" {
+					fmt.Fprint(w, tt.zones)
+					return
+				}
+				w.WriteHeader(tt.packs)
+				if tt.packsBody == "" {
+					fmt.Fprint(w, `{"result":[]}`)
+					return
+				}
+				fmt.Fprint(w, tt.packsBody)
+			}))
+			defer srv.Close()
+
+			c := NewClient(Credentials{Token: "token"}).
+				WithBaseURL(srv.URL).
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1})
+			got, err := c.MissingPermissions(context.Background(), "foobar.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error '%v', wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ResolveZone(t *testing.T) {
+	var lookups []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		lookups = append(lookups, name)
+		if name == "bar.com" {
+			fmt.Fprint(w, `{"result":[{"id":"zoneid","name":"bar.com"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"result":[]}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL)
+	for _, h := range []string{"www.staging.bar.com", "www.staging.bar.com", "bar.com"} {
+		z, err := c.ResolveZone(context.Background(), h)
+		if err != nil {
+			t.Fatalf("got error '%v'", err)
+		}
+		if z.ID != "zoneid" || z.Name != "bar.com" {
+			t.Errorf("got zone '%v', want '{zoneid bar.com}'", z)
+		}
+	}
+
+	want := "[www.staging.bar.com staging.bar.com bar.com]"
+	if fmt.Sprint(lookups) != want {
+		t.Errorf("got lookups '%v', want '%v'", lookups, want)
+	}
+
+	if _, err := c.ResolveZone(context.Background(), "foo.com"); err != ErrNoResult {
+		t.Errorf("got error '%v', want '%v'", err, ErrNoResult)
+	}
+}
+
+func TestCertificatePack_Covers(t *testing.T) {
+	p := CertificatePack{Hosts: []string{"bar.com", "*.bar.com", "*.dev.bar.com"}}
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{hostname: "bar.com", want: true},
+		{hostname: "www.bar.com", want: true},
+		{hostname: "WWW.bar.com.", want: true},
+		{hostname: "www.staging.bar.com", want: false},
+		{hostname: "dev.bar.com", want: true},
+		{hostname: "www.dev.bar.com", want: true},
+		{hostname: "api.www.dev.bar.com", want: false},
+		{hostname: "foo.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			if got := p.Covers(tt.hostname); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetDCVDelegationUUID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zoneid/dcv_delegation/uuid" {
+			t.Errorf("got path '%v'", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"success":true,"result":{"uuid":"abc123"}}`)
+	}))
+	defer srv.Close()
+
+	uuid, err := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).GetDCVDelegationUUID(context.Background(), "zoneid")
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	want := "www.bar.com.abc123.dcv.cloudflare.com"
+	for _, h := range []string{"www.bar.com", "*.www.bar.com"} {
+		if got := DCVDelegationTarget(h, uuid); got != want {
+			t.Errorf("got '%v', want '%v'", got, want)
+		}
+	}
+}
+
+func TestClient_ListCustomHostnames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zoneid/custom_hostnames" {
+			t.Errorf("got path '%v'", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"success":true,"result":[{
+			"id":"1","hostname":"app.bar.com","status":"active",
+			"ssl":{"status":"pending_validation","method":"txt","validation_records":[{"txt_name":"_acme-challenge.app.bar.com","txt_value":"abc"}]}
+		}],"result_info":{"page":1,"total_pages":1}}`)
+	}))
+	defer srv.Close()
+
+	got, err := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).ListCustomHostnames(context.Background(), "zoneid")
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(got) != 1 || got[0].Hostname != "app.bar.com" {
+		t.Fatalf("got '%v'", got)
+	}
+	if got[0].SSL.Status.Action() != ActionWriteTXT {
+		t.Errorf("got SSL status '%v', want '%v'", got[0].SSL.Status, StatusPendingValidation)
+	}
+	if vals := got[0].TXTRecords()["_acme-challenge.app.bar.com"]; len(vals) != 1 || vals[0] != "abc" {
+		t.Errorf("got TXT values '%v', want '[abc]'", vals)
+	}
+}
+
+func TestClient_OrderCertificatePack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("got method '%v', want 'POST'", r.Method)
+		}
+		if r.URL.Path != "/zones/zoneid/ssl/certificate_packs/order" {
+			t.Errorf("got path '%v'", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("cannot decode body: %v", err)
+		}
+		if body["type"] != "advanced" || body["certificate_authority"] != AuthorityLetsEncrypt ||
+			body["validity_days"] != float64(90) || body["validation_method"] != ValidationTXT {
+			t.Errorf("got body '%v'", body)
+		}
+		fmt.Fprint(w, `{"success":true,"result":{"id":"packid","status":"initializing","hosts":["bar.com","*.bar.com"]}}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewClient(Credentials{Token: "token"}).WithBaseURL(srv.URL).OrderCertificatePack(context.Background(), "zoneid", PackOrder{
+		Hosts:                []string{"bar.com", "*.bar.com"},
+		CertificateAuthority: AuthorityLetsEncrypt,
+		ValidityDays:         90,
+		ValidationMethod:     ValidationTXT,
+	})
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if p.ID != "packid" || p.Status != StatusInitializing {
+		t.Errorf("got '%v'", p)
+	}
+}
+
+func TestClient_OrderCertificatePack_retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int
+		wantErr   bool
+	}{
+		// the order may have been processed, it is not sent again
+		{name: "server error", status: http.StatusBadGateway, wantCalls: 1, wantErr: true},
+		// the order was not processed, it is sent again
+		{name: "rate limited", status: http.StatusTooManyRequests, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"success":true,"result":{"id":"1","type":"advanced","status":"initializing"}}`)
+			}))
+			defer srv.Close()
+
+			c := NewClient(Credentials{Token: "token"}).
+				WithBaseURL(srv.URL).
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 4, MinBackoff: time.Millisecond})
+			_, err := c.OrderCertificatePack(context.Background(), "zoneid", PackOrder{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error '%v', wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNeedsNewPack(t *testing.T) {
+	tests := []struct {
+		name  string
+		packs []CertificatePack
+		want  bool
+	}{
+		{name: "no pack", packs: nil, want: true},
+		{name: "expired and deleted", packs: []CertificatePack{{Type: "advanced", Status: StatusExpired}, {Type: "advanced", Status: StatusDeleted}}, want: true},
+		{name: "one pending", packs: []CertificatePack{{Type: "advanced", Status: StatusExpired}, {Type: "advanced", Status: StatusPendingValidation}}, want: false},
+		{name: "active", packs: []CertificatePack{{Type: "advanced", Status: StatusActive}}, want: false},
+		{name: "active universal", packs: []CertificatePack{{Type: "universal", Status: StatusActive}, {Type: "advanced", Status: StatusExpired}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsNewPack(tt.packs); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_get_context(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "hung.com" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	newClient := func() *Client {
+		return NewClient(Credentials{Token: "token"}).
+			WithBaseURL(srv.URL).
+			WithRateLimit(1000, 10).
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 10, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	}
+
+	t.Run("call timeout", func(t *testing.T) {
+		_, err := newClient().WithCallTimeout(50*time.Millisecond).GetZoneID(context.Background(), "hung.com")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error '%v', want '%v'", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("backoff beyond call timeout", func(t *testing.T) {
+		_, err := newClient().WithCallTimeout(time.Minute).GetZoneID(context.Background(), "foobar.com")
+		if !IsServerError(err) {
+			t.Errorf("got error '%v', want a server error", err)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		_, err := newClient().GetZoneID(ctx, "foobar.com")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error '%v', want '%v'", err, context.Canceled)
+		}
+	})
+}
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "server error", err: &APIError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "timeout", err: &url.Error{Op: "Get", Err: &net.DNSError{IsTimeout: true}}, want: true},
+		{name: "connection reset", err: &url.Error{Op: "Get", Err: syscall.ECONNRESET}, want: true},
+		{name: "connection closed", err: &url.Error{Op: "Get", Err: io.EOF}, want: true},
+		{name: "unknown host", err: &url.Error{Op: "Get", Err: &net.DNSError{IsNotFound: true}}, want: false},
+		{name: "connection refused", err: &url.Error{Op: "Get", Err: syscall.ECONNREFUSED}, want: false},
+		{name: "invalid certificate", err: &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// CustomHostname is a Cloudflare for SaaS custom hostname
+type CustomHostname struct {
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	// Status is the status of the hostname ownership verification
+	Status                string `json:"status"`
+	OwnershipVerification struct {
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"ownership_verification"`
+	SSL struct {
+		ID                string              `json:"id"`
+		Status            PackStatus          `json:"status"`
+		Method            string              `json:"method"`
+		ValidationRecords []ValidationRecords `json:"validation_records,omitempty"`
+	} `json:"ssl"`
+}
+
+// TXTRecords returns the TXT values Cloudflare expects to validate the
+// certificate of the custom hostname, grouped by record name
+func (h CustomHostname) TXTRecords() map[string][]string {
+	ret := make(map[string][]string)
+	for _, v := range h.SSL.ValidationRecords {
+		if v.TxtName != "" && v.TxtValue != "" {
+			ret[v.TxtName] = append(ret[v.TxtName], v.TxtValue)
+		}
+	}
+	return ret
+}
+
+// ListCustomHostnames returns all the custom hostnames of the zone id
+func (c *Client) ListCustomHostnames(ctx context.Context, id string) ([]CustomHostname, error) {
+	return list[CustomHostname](ctx, c, fmt.Sprintf("/zones/%s/custom_hostnames", id), url.Values{})
+}
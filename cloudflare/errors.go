@@ -0,0 +1,100 @@
+package cloudflare
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cloudflare error codes returned for invalid or missing credentials, with an
+// HTTP 400, 401 or 403. Valid credentials missing a permission get an HTTP 403
+// with other codes, such as 9109 or 10000.
+var authErrorCodes = map[int]bool{
+	1000: true, // invalid API token
+	6003: true, // invalid request headers
+	6111: true, // invalid format for Authorization header
+	9103: true, // unknown X-Auth-Key or X-Auth-Email
+	9106: true, // missing X-Auth-Key
+	9107: true, // missing X-Auth-Email
+}
+
+// ResponseInfo is an entry of the errors or messages arrays of a Cloudflare
+// API response
+type ResponseInfo struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// envelope holds the fields common to every Cloudflare API response
+type envelope struct {
+	Success  bool           `json:"success"`
+	Errors   []ResponseInfo `json:"errors"`
+	Messages []ResponseInfo `json:"messages"`
+}
+
+// APIError is returned when Cloudflare API answers with a non 2xx HTTP status
+// or with an unsuccessful response
+type APIError struct {
+	StatusCode int
+	// RetryAfter is the waiting time asked by Cloudflare before sending
+	// another request, if any
+	RetryAfter time.Duration
+	Errors     []ResponseInfo
+	Messages   []ResponseInfo
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("cloudflare API error: HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	var msgs []string
+	for _, v := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%d: %s", v.Code, v.Message))
+	}
+	return fmt.Sprintf("cloudflare API error: HTTP %d: %s", e.StatusCode, strings.Join(msgs, ", "))
+}
+
+// hasCode returns true if one of the errors has a code in codes
+func (e *APIError) hasCode(codes map[int]bool) bool {
+	for _, v := range e.Errors {
+		if codes[v.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAuthError returns true if err is an APIError caused by invalid or missing
+// credentials. The error codes are checked first, since Cloudflare answers a
+// wrong API key with an HTTP 403 as well.
+func IsAuthError(err error) bool {
+	var e *APIError
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.hasCode(authErrorCodes) || e.StatusCode == http.StatusUnauthorized
+}
+
+// IsPermissionError returns true if err is an APIError caused by credentials
+// missing the permissions required by the call: an HTTP 403 not caused by
+// invalid credentials.
+func IsPermissionError(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.StatusCode == http.StatusForbidden && !e.hasCode(authErrorCodes)
+}
+
+// IsRateLimited returns true if err is an APIError caused by too many requests
+func IsRateLimited(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServerError returns true if err is an APIError caused by a Cloudflare
+// internal error
+func IsServerError(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.StatusCode >= http.StatusInternalServerError
+}
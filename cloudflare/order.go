@@ -0,0 +1,65 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+)
+
+// Certificate authorities an advanced certificate pack can be ordered from
+const (
+	AuthorityLetsEncrypt = "lets_encrypt"
+	AuthorityGoogle      = "google"
+	AuthoritySSLCom      = "ssl_com"
+)
+
+// PackOrder describes an advanced certificate pack to order
+type PackOrder struct {
+	// Hosts must contain the zone apex
+	Hosts                []string `json:"hosts"`
+	CertificateAuthority string   `json:"certificate_authority"`
+	ValidityDays         int      `json:"validity_days"`
+	ValidationMethod     string   `json:"validation_method"`
+}
+
+// OrderCertificatePack orders a new advanced certificate pack in the zone id.
+// The returned pack is usually still initializing: its validation records are
+// only available once Cloudflare processed the order.
+func (c *Client) OrderCertificatePack(ctx context.Context, id string, order PackOrder) (CertificatePack, error) {
+	type request struct {
+		Type string `json:"type"`
+		PackOrder
+		CloudflareBranding bool `json:"cloudflare_branding"`
+	}
+	type APISchema struct {
+		Result CertificatePack `json:"result"`
+	}
+
+	var holder APISchema
+	path := fmt.Sprintf("/zones/%s/ssl/certificate_packs/order", id)
+	if err := c.do(ctx, "POST", path, request{Type: "advanced", PackOrder: order}, &holder); err != nil {
+		return CertificatePack{}, err
+	}
+	c.cache.delete(packsCacheKey(id))
+
+	if holder.Result.ID == "" {
+		return CertificatePack{}, ErrEmptyResponse
+	}
+
+	return holder.Result, nil
+}
+
+// NeedsNewPack returns true if none of the advanced packs of packs can ever
+// become active again, that is if there is no advanced pack at all or if they
+// are all expired or deleted. The other packs, such as the universal one, are
+// not managed by cfcr and are ignored.
+func NeedsNewPack(packs []CertificatePack) bool {
+	for _, p := range packs {
+		if p.Type != "advanced" {
+			continue
+		}
+		if p.Status != StatusExpired && p.Status != StatusDeleted {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+)
+
+// Permission is a Cloudflare API token permission required by cfcr
+type Permission string
+
+const (
+	PermissionZoneRead Permission = "Zone:Read"
+	PermissionSSLRead  Permission = "SSL and Certificates:Read"
+)
+
+// Verify checks that the credentials are accepted by Cloudflare. For an API
+// token, its status must also be active.
+func (c *Client) Verify(ctx context.Context) error {
+	if c.Credentials.Token == "" {
+		// Global API Keys cannot be verified as such, but any call on the
+		// user endpoint fails if they are not valid
+		var holder struct{}
+		return c.get(ctx, "/user", &holder)
+	}
+
+	type APISchema struct {
+		Result struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+
+	var holder APISchema
+	if err := c.get(ctx, "/user/tokens/verify", &holder); err != nil {
+		return err
+	}
+
+	if holder.Result.Status != "active" {
+		return fmt.Errorf("cloudflare token status is '%s'", holder.Result.Status)
+	}
+	return nil
+}
+
+// MissingPermissions probes the permissions of the credentials on the zone
+// name and returns the ones that are missing. An error is only returned if
+// the probing itself failed.
+func (c *Client) MissingPermissions(ctx context.Context, name string) ([]Permission, error) {
+	// a token that cannot read a zone does not get an error, the zone is
+	// simply not listed
+	z, err := c.ResolveZone(ctx, name)
+	if err == ErrNoResult || IsPermissionError(err) {
+		return []Permission{PermissionZoneRead, PermissionSSLRead}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.GetCertificatePacks(ctx, z.ID)
+	if IsPermissionError(err) {
+		return []Permission{PermissionSSLRead}, nil
+	}
+	if err != nil && err != ErrNoResult {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,99 @@
+package cloudflare
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRequestsPerSecond keeps the client under the Cloudflare global
+	// budget of 1200 requests per 5 minutes
+	DefaultRequestsPerSecond = 4
+	// DefaultBurst is the number of requests that can be sent at once before
+	// the rate limiter kicks in
+	DefaultBurst = 4
+)
+
+// RetryPolicy describes how the requests failing with a transient error (rate
+// limiting, Cloudflare internal error or network error) are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// MinBackoff is the waiting time before the first retry. It is doubled on
+	// each subsequent retry
+	MinBackoff time.Duration
+	// MaxBackoff caps the waiting time between two attempts. The one asked by
+	// a Retry-After header is never shortened
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the backoff that is randomly added or removed
+	// to spread the retries, between 0 and 1
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the policy used by a Client unless told otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  time.Second,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+}
+
+// backoff returns the duration to wait after the attempt numbered attempt
+// (starting at 1) failed with err
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var e *APIError
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		return e.RetryAfter
+	}
+
+	d := float64(p.MinBackoff) * math.Pow(2, float64(attempt-1))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return minDuration(time.Duration(d), p.MaxBackoff)
+}
+
+// isRetryable returns true if err is worth another attempt. Network errors are
+// only retried when transient: a permanent failure such as an unknown host or
+// an invalid certificate would fail the same way again.
+func isRetryable(err error) bool {
+	if IsRateLimited(err) || IsServerError(err) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	// the connection was closed while the request was in flight
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter reads the Retry-After header of r, which is either a number
+// of seconds or an HTTP date
+func parseRetryAfter(r *http.Response) time.Duration {
+	v := r.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if b > 0 && a > b {
+		return b
+	}
+	return a
+}
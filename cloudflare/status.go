@@ -0,0 +1,95 @@
+package cloudflare
+
+// PackStatus is the status of a certificate pack, as returned by Cloudflare API
+type PackStatus string
+
+const (
+	StatusInitializing         PackStatus = "initializing"
+	StatusPendingValidation    PackStatus = "pending_validation"
+	StatusPendingIssuance      PackStatus = "pending_issuance"
+	StatusPendingDeployment    PackStatus = "pending_deployment"
+	StatusStagingDeployment    PackStatus = "staging_deployment"
+	StatusHoldingDeployment    PackStatus = "holding_deployment"
+	StatusStagingActive        PackStatus = "staging_active"
+	StatusActive               PackStatus = "active"
+	StatusBackupIssued         PackStatus = "backup_issued"
+	StatusPendingExpiration    PackStatus = "pending_expiration"
+	StatusExpired              PackStatus = "expired"
+	StatusPendingCleanup       PackStatus = "pending_cleanup"
+	StatusPendingDeletion      PackStatus = "pending_deletion"
+	StatusDeactivating         PackStatus = "deactivating"
+	StatusInactive             PackStatus = "inactive"
+	StatusDeleted              PackStatus = "deleted"
+	StatusInitializingTimedOut PackStatus = "initializing_timed_out"
+	StatusValidationTimedOut   PackStatus = "validation_timed_out"
+	StatusIssuanceTimedOut     PackStatus = "issuance_timed_out"
+	StatusDeploymentTimedOut   PackStatus = "deployment_timed_out"
+	StatusDeletionTimedOut     PackStatus = "deletion_timed_out"
+)
+
+// Action is what has to be done for a certificate pack in a given status
+type Action int
+
+const (
+	// ActionUnknown is returned for a status that is not known by cfcr
+	ActionUnknown Action = iota
+	// ActionNone means the certificates are deployed and validation records
+	// are not needed anymore
+	ActionNone
+	// ActionWait means Cloudflare is working on the pack and nothing has to be
+	// done for now
+	ActionWait
+	// ActionWriteTXT means the validation records have to be published
+	ActionWriteTXT
+	// ActionRevalidate means Cloudflare gave up validating the pack and the
+	// validation has to be triggered again
+	ActionRevalidate
+	// ActionAlert means the pack is in a state that requires a human
+	ActionAlert
+)
+
+var statusActions = map[PackStatus]Action{
+	StatusActive:               ActionNone,
+	StatusStagingActive:        ActionNone,
+	StatusInitializing:         ActionWait,
+	StatusPendingIssuance:      ActionWait,
+	StatusPendingDeployment:    ActionWait,
+	StatusStagingDeployment:    ActionWait,
+	StatusHoldingDeployment:    ActionWait,
+	StatusBackupIssued:         ActionWait,
+	StatusPendingExpiration:    ActionWait,
+	StatusPendingCleanup:       ActionWait,
+	StatusPendingDeletion:      ActionWait,
+	StatusDeactivating:         ActionWait,
+	StatusPendingValidation:    ActionWriteTXT,
+	StatusValidationTimedOut:   ActionRevalidate,
+	StatusExpired:              ActionAlert,
+	StatusInactive:             ActionAlert,
+	StatusDeleted:              ActionAlert,
+	StatusInitializingTimedOut: ActionAlert,
+	StatusIssuanceTimedOut:     ActionAlert,
+	StatusDeploymentTimedOut:   ActionAlert,
+	StatusDeletionTimedOut:     ActionAlert,
+}
+
+// Action returns what has to be done for a pack in status s
+func (s PackStatus) Action() Action {
+	return statusActions[s]
+}
+
+func (a Action) String() string {
+	switch a {
+	case ActionNone:
+		return "none"
+	case ActionWait:
+		return "wait"
+	case ActionWriteTXT:
+		return "write TXT"
+	case ActionRevalidate:
+		return "revalidate"
+	case ActionAlert:
+		return "alert"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,86 @@
+package cloudflare
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Zone is a Cloudflare zone
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListZones returns all the zones visible to the credentials, restricted to
+// the client account if any
+func (c *Client) ListZones(ctx context.Context) ([]Zone, error) {
+	params := url.Values{}
+	if c.AccountID != "" {
+		params.Set("account.id", c.AccountID)
+	}
+	return list[Zone](ctx, c, "/zones", params)
+}
+
+// ResolveZone returns the zone owning hostname, walking up its labels until
+// a zone is found: www.staging.bar.com is looked up as is, then as
+// staging.bar.com and finally as bar.com. Results are cached for the lifetime
+// of the client. ErrNoResult is returned if no zone owns hostname.
+func (c *Client) ResolveZone(ctx context.Context, hostname string) (Zone, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	var z Zone
+	if c.cache.get(c.zoneCacheKey(hostname), &z) {
+		return z, nil
+	}
+
+	labels := strings.Split(hostname, ".")
+	// a zone has at least two labels, there is no point asking for a TLD
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+		id, err := c.GetZoneID(ctx, name)
+		if err == ErrNoResult {
+			continue
+		}
+		if err != nil {
+			return Zone{}, err
+		}
+
+		z := Zone{ID: id, Name: name}
+		c.cache.set(c.zoneCacheKey(hostname), z, c.zoneTTL)
+		c.cache.set(c.zoneCacheKey(name), z, c.zoneTTL)
+		return z, nil
+	}
+
+	return Zone{}, ErrNoResult
+}
+
+// zoneCacheKey includes the account ID since the same hostname can be looked
+// up by clients restricted to different accounts
+func (c *Client) zoneCacheKey(hostname string) string {
+	return "zone:" + c.AccountID + ":" + hostname
+}
+
+// Covers returns true if one of the hosts of the pack matches hostname,
+// either exactly or through a wildcard. The base name of a wildcard is
+// covered as well, since the validation records of the wildcard are set on
+// it.
+func (p CertificatePack) Covers(hostname string) bool {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	for _, h := range p.Hosts {
+		h = strings.ToLower(h)
+		if h == hostname {
+			return true
+		}
+		// a wildcard only covers a single label
+		if strings.HasPrefix(h, "*.") {
+			if h[2:] == hostname {
+				return true
+			}
+			if i := strings.Index(hostname, "."); i > 0 && hostname[i+1:] == h[2:] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,11 +1,12 @@
 package config
 
 import (
-	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
@@ -15,19 +16,155 @@ type Config struct {
 	Logging Logging `yaml:"logging"`
 	Auth    struct {
 		Cloudflare struct {
-			Token string `yaml:"token"`
+			// the credentials set at the root are the ones of the default
+			// account
+			CloudflareAccount `yaml:",inline"`
+			Accounts          map[string]CloudflareAccount `yaml:"accounts"`
 		} `yaml:"cloudflare"`
 		OVH struct {
 			AppKey      string `yaml:"app_key"`
 			AppSecret   string `yaml:"app_secret"`
 			ConsumerKey string `yaml:"consumer_key"`
 		} `yaml:"ovh"`
+		Route53 struct {
+			AccessKeyID     string `yaml:"access_key_id"`
+			SecretAccessKey string `yaml:"secret_access_key"`
+			SessionToken    string `yaml:"session_token"`
+			// HostedZoneID skips the hosted zone lookup
+			HostedZoneID string `yaml:"hosted_zone_id"`
+			Endpoint     string `yaml:"endpoint"`
+		} `yaml:"route53"`
+		GCloud struct {
+			// ServiceAccountFile is the path of the service account JSON key
+			ServiceAccountFile string `yaml:"service_account_file"`
+			// Project defaults to the project of the service account
+			Project string `yaml:"project"`
+			// ManagedZone skips the managed zone lookup
+			ManagedZone string `yaml:"managed_zone"`
+			Endpoint    string `yaml:"endpoint"`
+		} `yaml:"gcloud"`
+		Azure struct {
+			TenantID       string `yaml:"tenant_id"`
+			ClientID       string `yaml:"client_id"`
+			ClientSecret   string `yaml:"client_secret"`
+			SubscriptionID string `yaml:"subscription_id"`
+			ResourceGroup  string `yaml:"resource_group"`
+			// Zone skips the zone lookup
+			Zone string `yaml:"zone"`
+			// Authority and Resource are only needed outside of Azure public
+			// cloud
+			Authority string `yaml:"authority"`
+			Resource  string `yaml:"resource"`
+		} `yaml:"azure"`
+		RFC2136 struct {
+			// Server is the address of the primary server, port included
+			Server string `yaml:"server"`
+			Zone   string `yaml:"zone"`
+			// Net is either udp (the default) or tcp
+			Net string `yaml:"net"`
+			// the updates are only signed if KeyName is set
+			KeyName      string `yaml:"key_name"`
+			KeyAlgorithm string `yaml:"key_algorithm"`
+			KeySecret    string `yaml:"key_secret"`
+		} `yaml:"rfc2136"`
+		PowerDNS struct {
+			// Endpoint is the base URL of the API, without the /api/v1 suffix
+			Endpoint string `yaml:"endpoint"`
+			APIKey   string `yaml:"api_key"`
+			ServerID string `yaml:"server_id"`
+			// Zone skips the zone lookup
+			Zone    string `yaml:"zone"`
+			Notify  bool   `yaml:"notify"`
+			Rectify bool   `yaml:"rectify"`
+		} `yaml:"powerdns"`
+		S3 struct {
+			AccessKeyID     string `yaml:"access_key_id"`
+			SecretAccessKey string `yaml:"secret_access_key"`
+		} `yaml:"s3"`
 	} `yaml:"auth"`
 	Checks struct {
 		BaseDomain string   `yaml:"base_domain"`
 		Frequency  string   `yaml:"frequency"`
-		Domains    []string `yaml:"domains"`
+		Domains    []Domain `yaml:"domains"`
+		// Discovery builds the list of domains to watch from the certificate
+		// packs found on Cloudflare, in addition to Domains
+		Discovery struct {
+			Enabled bool `yaml:"enabled"`
+			// Accounts restricts the discovery to these Cloudflare accounts.
+			// All the configured accounts are used if empty
+			Accounts []string `yaml:"accounts"`
+			// Zones are glob patterns the zone names must match
+			Zones []string `yaml:"zones"`
+			// Include and Exclude are glob patterns the hostnames must, or
+			// must not, match
+			Include []string `yaml:"include"`
+			Exclude []string `yaml:"exclude"`
+		} `yaml:"discovery"`
+		// CustomHostnames lists the Cloudflare for SaaS zones whose custom
+		// hostnames are validated by cfcr
+		CustomHostnames []CustomHostnames `yaml:"custom_hostnames"`
+		// Ordering orders a new advanced certificate pack for the domains
+		// that have none, or whose packs are all expired or deleted
+		Ordering Ordering `yaml:"ordering"`
+		// RenewBeforeDays is the number of days before a certificate expiry
+		// below which a warning is emitted if its pack is still not pending
+		RenewBeforeDays int `yaml:"renew_before_days"`
+		// Revalidation waits for the published TXT records to be visible,
+		// then triggers Cloudflare validation again for the packs whose
+		// validation timed out instead of leaving them stuck
+		Revalidation struct {
+			Enabled            bool          `yaml:"enabled"`
+			PropagationTimeout time.Duration `yaml:"propagation_timeout"`
+			PollTimeout        time.Duration `yaml:"poll_timeout"`
+			PollInterval       time.Duration `yaml:"poll_interval"`
+		} `yaml:"revalidation"`
 	} `yaml:"checks"`
+	Cloudflare struct {
+		BaseURL   string        `yaml:"base_url"`
+		Timeout   time.Duration `yaml:"timeout"`
+		UserAgent string        `yaml:"user_agent"`
+		PerPage   int           `yaml:"per_page"`
+		Retry     struct {
+			MaxAttempts int           `yaml:"max_attempts"`
+			MinBackoff  time.Duration `yaml:"min_backoff"`
+			MaxBackoff  time.Duration `yaml:"max_backoff"`
+			Jitter      float64       `yaml:"jitter"`
+		} `yaml:"retry"`
+		RateLimit struct {
+			RequestsPerSecond float64 `yaml:"requests_per_second"`
+			Burst             int     `yaml:"burst"`
+		} `yaml:"rate_limit"`
+		Cache struct {
+			Path    string        `yaml:"path"`
+			ZoneTTL time.Duration `yaml:"zone_ttl"`
+			PackTTL time.Duration `yaml:"pack_ttl"`
+		} `yaml:"cache"`
+	} `yaml:"cloudflare"`
+	// HTTPChallenge configures where the tokens of the certificate packs
+	// validated over HTTP are published. Only one publisher can be used.
+	HTTPChallenge struct {
+		File struct {
+			Root string `yaml:"root"`
+		} `yaml:"file"`
+		S3 struct {
+			Endpoint string `yaml:"endpoint"`
+			Region   string `yaml:"region"`
+			Bucket   string `yaml:"bucket"`
+			Prefix   string `yaml:"prefix"`
+		} `yaml:"s3"`
+		Server struct {
+			Address string `yaml:"address"`
+			Port    string `yaml:"port"`
+		} `yaml:"server"`
+	} `yaml:"http_challenge"`
+	// Timeouts bound the calls to Cloudflare and to the provider, and the
+	// processing of each domain
+	Timeouts struct {
+		// Call bounds a single call, retries included
+		Call time.Duration `yaml:"call"`
+		// Domain bounds all the calls made for a single domain
+		Domain time.Duration `yaml:"domain"`
+	} `yaml:"timeouts"`
 	Metrics struct {
 		Enabled bool `yaml:"enabled"`
 		Server  struct {
@@ -37,6 +174,143 @@ type Config struct {
 	} `yaml:"metrics"`
 }
 
+const (
+	// DefaultCallTimeout bounds a single call to Cloudflare or to the provider
+	DefaultCallTimeout = time.Minute
+	// DefaultDomainTimeout bounds the processing of a domain. It leaves room
+	// for the revalidation, which waits for the DNS propagation and polls
+	// Cloudflare
+	DefaultDomainTimeout = 30 * time.Minute
+)
+
+// DefaultAccount is the name of the Cloudflare account whose credentials are
+// set at the root of .auth.cloudflare
+const DefaultAccount = "default"
+
+// CloudflareAccount holds the credentials of a Cloudflare account
+type CloudflareAccount struct {
+	Token   string `yaml:"token"`
+	Email   string `yaml:"email"`
+	APIKey  string `yaml:"api_key"`
+	Account struct {
+		// ID restricts the zone lookups to the zones of this account
+		ID string `yaml:"id"`
+	} `yaml:"account"`
+}
+
+// Domain is a watched domain. In the YAML configuration, it is either a plain
+// hostname, watched with the default Cloudflare account, or a mapping with the
+// hostname and the name of the account to use.
+type Domain struct {
+	Name    string `yaml:"name"`
+	Account string `yaml:"account"`
+}
+
+// UnmarshalYAML allows a domain to be given as a plain string
+func (d *Domain) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		d.Name = value.Value
+		d.Account = DefaultAccount
+		return nil
+	}
+
+	type plain Domain
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return err
+	}
+	*d = Domain(p)
+	if d.Account == "" {
+		d.Account = DefaultAccount
+	}
+	return nil
+}
+
+func (d Domain) String() string {
+	return d.Name
+}
+
+// CustomHostnames selects the custom hostnames of a Cloudflare for SaaS zone
+// that cfcr validates: only the ones whose DNS is managed by the provider must
+// be selected
+type CustomHostnames struct {
+	// Zone is the name of the SaaS zone holding the custom hostnames
+	Zone string `yaml:"zone"`
+	// Account is the name of the Cloudflare account of the zone
+	Account string `yaml:"account"`
+	// Hostnames are glob patterns the custom hostnames must match
+	Hostnames []string `yaml:"hostnames"`
+}
+
+// AccountName returns the name of the Cloudflare account of the zone, which
+// is the default one if not set
+func (ch CustomHostnames) AccountName() string {
+	if ch.Account == "" {
+		return DefaultAccount
+	}
+	return ch.Account
+}
+
+// Ordering holds the settings of the advanced certificate packs ordered by
+// cfcr
+type Ordering struct {
+	Enabled bool `yaml:"enabled"`
+	// Hosts are the hosts of the ordered pack. The {zone} and {domain}
+	// placeholders are replaced by the zone and the domain names
+	Hosts                []string `yaml:"hosts"`
+	CertificateAuthority string   `yaml:"certificate_authority"`
+	ValidityDays         int      `yaml:"validity_days"`
+	ValidationMethod     string   `yaml:"validation_method"`
+}
+
+// Default values of the ordered packs settings
+var (
+	DefaultOrderHosts                = []string{"{zone}", "{domain}", "*.{domain}"}
+	DefaultOrderCertificateAuthority = "lets_encrypt"
+	DefaultOrderValidityDays         = 90
+	DefaultOrderValidationMethod     = "txt"
+)
+
+var (
+	validCertificateAuthorities = []string{"lets_encrypt", "google", "ssl_com"}
+	validValidityDays           = []int{14, 30, 90, 365}
+	validValidationMethods      = []string{"txt", "http"}
+	validTSIGAlgorithms         = []string{"hmac-sha256", "hmac-sha512"}
+)
+
+// WithDefaults returns o with the unset fields set to their default value
+func (o Ordering) WithDefaults() Ordering {
+	if len(o.Hosts) == 0 {
+		o.Hosts = DefaultOrderHosts
+	}
+	if o.CertificateAuthority == "" {
+		o.CertificateAuthority = DefaultOrderCertificateAuthority
+	}
+	if o.ValidityDays == 0 {
+		o.ValidityDays = DefaultOrderValidityDays
+	}
+	if o.ValidationMethod == "" {
+		o.ValidationMethod = DefaultOrderValidationMethod
+	}
+	return o
+}
+
+// HostsFor returns the hosts of the pack ordered for domain in zone. The zone
+// apex is always part of them since Cloudflare requires it.
+func (o Ordering) HostsFor(zone, domain string) []string {
+	r := strings.NewReplacer("{zone}", zone, "{domain}", domain)
+	ret := []string{zone}
+	seen := map[string]bool{zone: true}
+	for _, h := range o.WithDefaults().Hosts {
+		h = r.Replace(h)
+		if !seen[h] {
+			seen[h] = true
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
 type Logging struct {
 	Level         string `yaml:"level"`
 	HumanReadable bool   `yaml:"human_readable"`
@@ -111,17 +385,233 @@ func (c Config) Validate() error {
 	}
 	zerolog.SetGlobalLevel(l)
 
-	if c.Auth.Cloudflare.Token == "" {
-		return errors.New("cloudflare configuration is incomplete: missing .auth.cloudflare.token field")
+	if err := c.validateCloudflareAuth(); err != nil {
+		return err
 	}
 
 	// parse and validate given frequency
 	if !isFreqValid(c.Checks.Frequency) {
 		return fmt.Errorf("frequency %s is not a valid one", c.Checks.Frequency)
 	}
+
+	if err := c.validateDiscovery(); err != nil {
+		return err
+	}
+
+	if err := c.validateCustomHostnames(); err != nil {
+		return err
+	}
+
+	if err := c.validateOrdering(); err != nil {
+		return err
+	}
+
+	if alg := c.Auth.RFC2136.KeyAlgorithm; alg != "" && !contains(validTSIGAlgorithms, alg) {
+		return fmt.Errorf("TSIG algorithm %s is not a valid one", alg)
+	}
+
+	if err := c.validateHTTPChallenge(); err != nil {
+		return err
+	}
+
+	if c.Timeouts.Call < 0 {
+		return fmt.Errorf("timeouts.call must be positive, got %s", c.Timeouts.Call)
+	}
+	if c.Timeouts.Domain < 0 {
+		return fmt.Errorf("timeouts.domain must be positive, got %s", c.Timeouts.Domain)
+	}
+
+	if c.Checks.RenewBeforeDays < 0 {
+		return fmt.Errorf("renew_before_days must be positive, got %d", c.Checks.RenewBeforeDays)
+	}
+	return nil
+}
+
+// CloudflareAccounts returns the credentials of every configured Cloudflare
+// account, indexed by account name. The default account is only returned if
+// its credentials are set.
+func (c Config) CloudflareAccounts() map[string]CloudflareAccount {
+	ret := make(map[string]CloudflareAccount, len(c.Auth.Cloudflare.Accounts)+1)
+	for name, acc := range c.Auth.Cloudflare.Accounts {
+		ret[name] = acc
+	}
+	if def := c.Auth.Cloudflare.CloudflareAccount; def.isSet() {
+		ret[DefaultAccount] = def
+	}
+	return ret
+}
+
+// CallTimeout returns the maximum duration of a single call to Cloudflare or to
+// the provider
+func (c Config) CallTimeout() time.Duration {
+	if c.Timeouts.Call == 0 {
+		return DefaultCallTimeout
+	}
+	return c.Timeouts.Call
+}
+
+// DomainTimeout returns the maximum duration of the processing of a domain
+func (c Config) DomainTimeout() time.Duration {
+	if c.Timeouts.Domain == 0 {
+		return DefaultDomainTimeout
+	}
+	return c.Timeouts.Domain
+}
+
+// validateCloudflareAuth checks that every Cloudflare account has exactly one
+// authentication scheme configured, and that every domain is mapped to a
+// configured account
+func (c Config) validateCloudflareAuth() error {
+	accounts := c.CloudflareAccounts()
+
+	// without any named account, the default one is mandatory
+	if len(c.Auth.Cloudflare.Accounts) == 0 {
+		if err := c.Auth.Cloudflare.CloudflareAccount.validate(".auth.cloudflare"); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := c.Auth.Cloudflare.Accounts[DefaultAccount]; ok && c.Auth.Cloudflare.CloudflareAccount.isSet() {
+		return fmt.Errorf("cloudflare configuration is ambiguous: account '%s' is configured twice", DefaultAccount)
+	}
+
+	for name, acc := range accounts {
+		path := ".auth.cloudflare"
+		if name != DefaultAccount {
+			path += ".accounts." + name
+		}
+		if err := acc.validate(path); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range c.Checks.Domains {
+		if _, ok := accounts[d.Account]; !ok {
+			return fmt.Errorf("domain %s uses Cloudflare account '%s' which is not configured", d.Name, d.Account)
+		}
+	}
 	return nil
 }
 
+// validateDiscovery checks that the discovery patterns are valid globs and
+// that the accounts it uses are configured
+func (c Config) validateDiscovery() error {
+	disc := c.Checks.Discovery
+	if !disc.Enabled {
+		return nil
+	}
+
+	accounts := c.CloudflareAccounts()
+	for _, a := range disc.Accounts {
+		if _, ok := accounts[a]; !ok {
+			return fmt.Errorf("discovery uses Cloudflare account '%s' which is not configured", a)
+		}
+	}
+
+	for _, patterns := range [][]string{disc.Zones, disc.Include, disc.Exclude} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("discovery pattern '%s' is not valid: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCustomHostnames checks that every SaaS zone has a name, valid
+// patterns and a configured account
+func (c Config) validateCustomHostnames() error {
+	accounts := c.CloudflareAccounts()
+	for _, ch := range c.Checks.CustomHostnames {
+		if ch.Zone == "" {
+			return fmt.Errorf("custom hostnames configuration is incomplete: missing zone field")
+		}
+
+		if _, ok := accounts[ch.AccountName()]; !ok {
+			return fmt.Errorf("custom hostnames of zone %s use Cloudflare account '%s' which is not configured", ch.Zone, ch.AccountName())
+		}
+
+		if len(ch.Hostnames) == 0 {
+			return fmt.Errorf("custom hostnames of zone %s have no hostnames pattern", ch.Zone)
+		}
+		for _, p := range ch.Hostnames {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("custom hostnames pattern '%s' is not valid: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOrdering checks that the ordered packs settings are supported by
+// Cloudflare
+func (c Config) validateHTTPChallenge() error {
+	var set []string
+	if c.HTTPChallenge.File.Root != "" {
+		set = append(set, "file")
+	}
+	if c.HTTPChallenge.S3.Bucket != "" {
+		set = append(set, "s3")
+	}
+	if c.HTTPChallenge.Server.Port != "" {
+		set = append(set, "server")
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("only one HTTP challenge publisher can be set, got %s", strings.Join(set, ", "))
+	}
+	return nil
+}
+
+func (c Config) validateOrdering() error {
+	o := c.Checks.Ordering
+	if !o.Enabled {
+		return nil
+	}
+	o = o.WithDefaults()
+
+	if !contains(validCertificateAuthorities, o.CertificateAuthority) {
+		return fmt.Errorf("certificate authority %s is not a valid one", o.CertificateAuthority)
+	}
+	if !contains(validValidityDays, o.ValidityDays) {
+		return fmt.Errorf("validity of %d days is not a valid one", o.ValidityDays)
+	}
+	if !contains(validValidationMethods, o.ValidationMethod) {
+		return fmt.Errorf("validation method %s is not a valid one", o.ValidationMethod)
+	}
+	for _, h := range o.Hosts {
+		if h == "" {
+			return fmt.Errorf("ordering configuration is invalid: empty host")
+		}
+	}
+	return nil
+}
+
+// isSet returns true if any credential of the account is set
+func (a CloudflareAccount) isSet() bool {
+	return a.Token != "" || a.Email != "" || a.APIKey != ""
+}
+
+// validate checks that exactly one authentication scheme is configured: either
+// an API token or the legacy email and Global API Key pair. path is the YAML
+// path of the account, used in the error messages.
+func (a CloudflareAccount) validate(path string) error {
+	legacy := a.Email != "" || a.APIKey != ""
+	switch {
+	case a.Token != "" && legacy:
+		return fmt.Errorf("cloudflare configuration is ambiguous: %[1]s.token cannot be used with %[1]s.email and %[1]s.api_key", path)
+	case a.Token != "":
+		return nil
+	case a.Email != "" && a.APIKey != "":
+		return nil
+	case a.Email != "":
+		return fmt.Errorf("cloudflare configuration is incomplete: missing %s.api_key field", path)
+	case a.APIKey != "":
+		return fmt.Errorf("cloudflare configuration is incomplete: missing %s.email field", path)
+	default:
+		return fmt.Errorf("cloudflare configuration is incomplete: missing %s.token field", path)
+	}
+}
+
 // isFreqValid checks that f is a supported frequency
 func isFreqValid(f string) bool {
 	for _, ff := range validFrequencies {
@@ -132,6 +622,16 @@ func isFreqValid(f string) bool {
 	return false
 }
 
+// contains checks that v is one of values
+func contains[T comparable](values []T, v T) bool {
+	for _, vv := range values {
+		if v == vv {
+			return true
+		}
+	}
+	return false
+}
+
 // isYamlFile checks if the filename ends with either .yaml or .yml
 func isYamlFile(name string) bool {
 	if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
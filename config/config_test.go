@@ -1,7 +1,11 @@
 package config
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func Test_isFreqValid(t *testing.T) {
@@ -26,6 +30,16 @@ func Test_isFreqValid(t *testing.T) {
 	}
 }
 
+// validConfig returns a configuration that passes validation, modified by fn
+func validConfig(fn func(c *Config)) Config {
+	var c Config
+	c.Logging.Level = "info"
+	c.Auth.Cloudflare.Token = "abcdef"
+	c.Checks.Frequency = "daily"
+	fn(&c)
+	return c
+}
+
 func TestConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -46,16 +60,169 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:    "negative renewal window",
+			fields:  validConfig(func(c *Config) { c.Checks.RenewBeforeDays = -1 }),
+			wantErr: true,
+		},
+		{
+			name: "legacy auth",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Token = ""
+				c.Auth.Cloudflare.Email = "foo@bar.com"
+				c.Auth.Cloudflare.APIKey = "abcdef"
+			}),
+			wantErr: false,
+		},
+		{
+			name: "legacy auth without key",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Token = ""
+				c.Auth.Cloudflare.Email = "foo@bar.com"
+			}),
+			wantErr: true,
+		},
+		{
+			name: "both auth schemes",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Email = "foo@bar.com"
+				c.Auth.Cloudflare.APIKey = "abcdef"
+			}),
+			wantErr: true,
+		},
+		{
+			name: "named account only",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Token = ""
+				c.Auth.Cloudflare.Accounts = map[string]CloudflareAccount{"customers": {Token: "abcdef"}}
+				c.Checks.Domains = []Domain{{Name: "foo.com", Account: "customers"}}
+			}),
+			wantErr: false,
+		},
+		{
+			name: "unknown account",
+			fields: validConfig(func(c *Config) {
+				c.Checks.Domains = []Domain{{Name: "foo.com", Account: "customers"}}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "default account missing",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Token = ""
+				c.Auth.Cloudflare.Accounts = map[string]CloudflareAccount{"customers": {Token: "abcdef"}}
+				c.Checks.Domains = []Domain{{Name: "foo.com", Account: DefaultAccount}}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "incomplete named account",
+			fields: validConfig(func(c *Config) {
+				c.Auth.Cloudflare.Accounts = map[string]CloudflareAccount{"customers": {Email: "foo@bar.com"}}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "custom hostnames without patterns",
+			fields: validConfig(func(c *Config) {
+				c.Checks.CustomHostnames = []CustomHostnames{{Zone: "saas.com"}}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "custom hostnames with unknown account",
+			fields: validConfig(func(c *Config) {
+				c.Checks.CustomHostnames = []CustomHostnames{{Zone: "saas.com", Account: "foo", Hostnames: []string{"*"}}}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "custom hostnames",
+			fields: validConfig(func(c *Config) {
+				c.Checks.CustomHostnames = []CustomHostnames{{Zone: "saas.com", Hostnames: []string{"*.bar.com"}}}
+			}),
+			wantErr: false,
+		},
+		{
+			name: "ordering with invalid certificate authority",
+			fields: validConfig(func(c *Config) {
+				c.Checks.Ordering = Ordering{Enabled: true, CertificateAuthority: "foo"}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "ordering with invalid validity",
+			fields: validConfig(func(c *Config) {
+				c.Checks.Ordering = Ordering{Enabled: true, ValidityDays: 60}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "ordering with defaults",
+			fields: validConfig(func(c *Config) {
+				c.Checks.Ordering = Ordering{Enabled: true}
+			}),
+			wantErr: false,
+		},
+		{
+			name:    "rfc2136 with invalid TSIG algorithm",
+			fields:  validConfig(func(c *Config) { c.Auth.RFC2136.KeyAlgorithm = "hmac-md5" }),
+			wantErr: true,
+		},
+		{
+			name:    "zero timeouts",
+			fields:  validConfig(func(c *Config) { c.Timeouts.Call, c.Timeouts.Domain = 0, 0 }),
+			wantErr: false,
+		},
+		{
+			name:    "negative call timeout",
+			fields:  validConfig(func(c *Config) { c.Timeouts.Call = -time.Second }),
+			wantErr: true,
+		},
+		{
+			name:    "negative domain timeout",
+			fields:  validConfig(func(c *Config) { c.Timeouts.Domain = -time.Minute }),
+			wantErr: true,
+		},
+		{
+			name: "timeouts",
+			fields: validConfig(func(c *Config) {
+				c.Timeouts.Call = 2 * time.Minute
+				c.Timeouts.Domain = time.Hour
+			}),
+			wantErr: false,
+		},
+		{
+			name: "cloudflare client settings",
+			fields: validConfig(func(c *Config) {
+				c.Cloudflare.Timeout = 10 * time.Second
+				c.Cloudflare.Retry.MaxAttempts = 3
+				c.Cloudflare.RateLimit.RequestsPerSecond = 4
+			}),
+			wantErr: false,
+		},
+		{
+			name:    "http challenge",
+			fields:  validConfig(func(c *Config) { c.HTTPChallenge.File.Root = "/var/www" }),
+			wantErr: false,
+		},
+		{
+			name: "several http challenge publishers",
+			fields: validConfig(func(c *Config) {
+				c.HTTPChallenge.File.Root = "/var/www"
+				c.HTTPChallenge.S3.Bucket = "bucket"
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "valid",
+			fields:  validConfig(func(c *Config) { c.Checks.RenewBeforeDays = 14 }),
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := Config{
-				Logging: tt.fields.Logging,
-				Auth:    tt.fields.Auth,
-				Checks:  tt.fields.Checks,
-				Metrics: tt.fields.Metrics,
-			}
-			if err := c.Validate(); (err != nil) != tt.wantErr {
+			if err := tt.fields.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -81,3 +248,55 @@ func Test_isYamlFile(t *testing.T) {
 		})
 	}
 }
+
+func TestDomain_UnmarshalYAML(t *testing.T) {
+	data := `
+domains:
+  - www.bar.com
+  - name: shop.foo.com
+    account: customers
+  - name: blog.bar.com
+`
+	var holder struct {
+		Domains []Domain `yaml:"domains"`
+	}
+	if err := yaml.Unmarshal([]byte(data), &holder); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	want := []Domain{
+		{Name: "www.bar.com", Account: DefaultAccount},
+		{Name: "shop.foo.com", Account: "customers"},
+		{Name: "blog.bar.com", Account: DefaultAccount},
+	}
+	if len(holder.Domains) != len(want) {
+		t.Fatalf("got %d domains, want %d", len(holder.Domains), len(want))
+	}
+	for i := range want {
+		if holder.Domains[i] != want[i] {
+			t.Errorf("got '%v', want '%v'", holder.Domains[i], want[i])
+		}
+	}
+}
+
+func TestOrdering_HostsFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		hosts  []string
+		zone   string
+		domain string
+		want   []string
+	}{
+		{name: "defaults on zone", zone: "bar.com", domain: "bar.com", want: []string{"bar.com", "*.bar.com"}},
+		{name: "defaults on subdomain", zone: "bar.com", domain: "www.bar.com", want: []string{"bar.com", "www.bar.com", "*.www.bar.com"}},
+		{name: "custom hosts", hosts: []string{"{domain}", "api.{zone}"}, zone: "bar.com", domain: "www.bar.com", want: []string{"bar.com", "www.bar.com", "api.bar.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Ordering{Hosts: tt.hosts}.HostsFor(tt.zone, tt.domain)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenURI is the Google OAuth 2.0 token endpoint, used if the
+	// service account key does not give one
+	DefaultTokenURI = "https://oauth2.googleapis.com/token"
+
+	grantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// tokens are renewed a bit before they expire so that a request never
+	// carries an expired token
+	expiryMargin = time.Minute
+)
+
+// ServiceAccount holds the fields of a Google Cloud service account JSON key
+// needed to get access tokens
+type ServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// LoadServiceAccount reads the service account JSON key file path
+func LoadServiceAccount(path string) (ServiceAccount, error) {
+	var sa ServiceAccount
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sa, err
+	}
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return sa, fmt.Errorf("cannot parse service account key %s: %w", path, err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return sa, fmt.Errorf("service account key %s has no client_email or private_key", path)
+	}
+	return sa, nil
+}
+
+// TokenSource gets access tokens for a service account using the OAuth 2.0
+// JWT bearer flow. Tokens are cached until they expire, a single TokenSource
+// should be shared by all the requests.
+type TokenSource struct {
+	Account ServiceAccount
+	Scopes  []string
+	Client  *http.Client
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewTokenSource creates a TokenSource for sa, granting scopes
+func NewTokenSource(sa ServiceAccount, scopes ...string) (*TokenSource, error) {
+	key, err := parsePrivateKey(sa.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSource{Account: sa, Scopes: scopes, key: key}, nil
+}
+
+// Token returns a valid access token, getting a new one if needed
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Add(expiryMargin).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	tokenURI := ts.Account.TokenURI
+	if tokenURI == "" {
+		tokenURI = DefaultTokenURI
+	}
+	now := time.Now()
+	assertion, err := ts.assertion(tokenURI, now)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {grantType}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := ts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	if r.StatusCode >= 300 {
+		return "", fmt.Errorf("token endpoint returned HTTP %d: %s", r.StatusCode, data)
+	}
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("token endpoint returned no access token")
+	}
+
+	ts.token = res.AccessToken
+	ts.expiry = now.Add(time.Duration(res.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+// assertion returns the JWT signed with the service account key, asking for
+// a token valid for an hour
+func (ts *TokenSource) assertion(aud string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   ts.Account.ClientEmail,
+		"scope": strings.Join(ts.Scopes, " "),
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	h := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA key, either PKCS#8 as found in the
+// service account keys or PKCS#1
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,11 +11,23 @@ import (
 	"time"
 
 	"github.com/govirtuo/cfcr/app"
+	"github.com/govirtuo/cfcr/awsauth"
+	"github.com/govirtuo/cfcr/azureauth"
 	"github.com/govirtuo/cfcr/cloudflare"
 	"github.com/govirtuo/cfcr/config"
+	"github.com/govirtuo/cfcr/gcpauth"
 	"github.com/govirtuo/cfcr/metrics"
 	"github.com/govirtuo/cfcr/providers"
+	"github.com/govirtuo/cfcr/providers/azure"
+	"github.com/govirtuo/cfcr/providers/gcloud"
 	"github.com/govirtuo/cfcr/providers/ovh"
+	"github.com/govirtuo/cfcr/providers/powerdns"
+	"github.com/govirtuo/cfcr/providers/rfc2136"
+	"github.com/govirtuo/cfcr/providers/route53"
+	"github.com/govirtuo/cfcr/publishers"
+	"github.com/govirtuo/cfcr/publishers/file"
+	"github.com/govirtuo/cfcr/publishers/s3"
+	"github.com/govirtuo/cfcr/publishers/server"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -24,6 +37,10 @@ var (
 	BuildDate string
 )
 
+// migrateDCVCommand is the command delegating the DCV of the watched domains
+// to Cloudflare
+const migrateDCVCommand = "migrate-dcv"
+
 func main() {
 	var runOnce bool
 	var dryRun bool
@@ -31,12 +48,25 @@ func main() {
 	flag.BoolVar(&runOnce, "run-once", false, "Only one loop over the domains list will be performed.")
 	flag.BoolVar(&dryRun, "dry-run", false, "Run in dry mode: no writing action will be performed, only reading.")
 	flag.StringVar(&configDir, "config-dir", "conf.d", "Path to configuration directory.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n\tDelegate the DCV of the watched domains to Cloudflare and exit.\n\n", migrateDCVCommand)
+		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	a, err := app.Create()
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot create app")
 	}
+
+	command := flag.Arg(0)
+	if command != "" && command != migrateDCVCommand {
+		flag.Usage()
+		a.Logger.Fatal().Msgf("unknown command '%s'", command)
+	}
 	a.Logger.Info().Msgf("%s version %s (built: %s)", os.Args[0], Version, BuildDate)
 
 	// parse, read and validate the various configuration files
@@ -55,6 +85,9 @@ func main() {
 		len(a.Config.Checks.Domains))
 
 	a.Logger.Debug().Msgf("%s", a.Config.Checks.Domains)
+	if a.Config.Checks.Discovery.Enabled {
+		a.Logger.Info().Msg("domains discovery is enabled, the list of domains will be completed on each run")
+	}
 	if runOnce {
 		a.Logger.Info().Msgf("%s will run once", os.Args[0])
 	} else {
@@ -100,7 +133,6 @@ func main() {
 	switch providers.ProviderToUse(*a.Config) {
 	case providers.List[providers.OVH]:
 		a.Logger.Info().Msg("the detected provider is OVH")
-		subdomain := "_acme-challenge"
 		covh := ovh.Credentials{
 			ApplicationKey:    a.Config.Auth.OVH.AppKey,
 			ApplicationSecret: a.Config.Auth.OVH.AppSecret,
@@ -109,30 +141,176 @@ func main() {
 		a.Provider = ovh.OVHProvider{
 			Credentials: covh,
 			BaseDomain:  a.Config.Checks.BaseDomain,
-			Subdomain:   subdomain,
+		}
+	case providers.List[providers.ROUTE53]:
+		a.Logger.Info().Msg("the detected provider is Route 53")
+		a.Provider = route53.Route53Provider{
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     a.Config.Auth.Route53.AccessKeyID,
+				SecretAccessKey: a.Config.Auth.Route53.SecretAccessKey,
+				SessionToken:    a.Config.Auth.Route53.SessionToken,
+			},
+			Endpoint:     a.Config.Auth.Route53.Endpoint,
+			HostedZoneID: a.Config.Auth.Route53.HostedZoneID,
+		}
+	case providers.List[providers.GCLOUD]:
+		a.Logger.Info().Msg("the detected provider is Google Cloud DNS")
+		sa, err := gcpauth.LoadServiceAccount(a.Config.Auth.GCloud.ServiceAccountFile)
+		if err != nil {
+			a.Logger.Fatal().Err(err).Msg("cannot load Google Cloud service account key")
+		}
+		tokens, err := gcpauth.NewTokenSource(sa, gcloud.Scope)
+		if err != nil {
+			a.Logger.Fatal().Err(err).Msg("cannot load Google Cloud service account key")
+		}
+		project := a.Config.Auth.GCloud.Project
+		if project == "" {
+			project = sa.ProjectID
+		}
+		a.Provider = gcloud.GCloudProvider{
+			Tokens:      tokens,
+			Project:     project,
+			ManagedZone: a.Config.Auth.GCloud.ManagedZone,
+			Endpoint:    a.Config.Auth.GCloud.Endpoint,
+		}
+	case providers.List[providers.AZURE]:
+		a.Logger.Info().Msg("the detected provider is Azure DNS")
+		a.Provider = azure.AzureProvider{
+			Tokens: azureauth.NewTokenSource(azureauth.ClientCredentials{
+				TenantID:     a.Config.Auth.Azure.TenantID,
+				ClientID:     a.Config.Auth.Azure.ClientID,
+				ClientSecret: a.Config.Auth.Azure.ClientSecret,
+				Authority:    a.Config.Auth.Azure.Authority,
+				Resource:     a.Config.Auth.Azure.Resource,
+			}),
+			SubscriptionID: a.Config.Auth.Azure.SubscriptionID,
+			ResourceGroup:  a.Config.Auth.Azure.ResourceGroup,
+			Zone:           a.Config.Auth.Azure.Zone,
+		}
+	case providers.List[providers.RFC2136]:
+		a.Logger.Info().Msg("the detected provider is RFC 2136")
+		a.Provider = rfc2136.RFC2136Provider{
+			Server:       a.Config.Auth.RFC2136.Server,
+			Zone:         a.Config.Auth.RFC2136.Zone,
+			Net:          a.Config.Auth.RFC2136.Net,
+			KeyName:      a.Config.Auth.RFC2136.KeyName,
+			KeyAlgorithm: a.Config.Auth.RFC2136.KeyAlgorithm,
+			KeySecret:    a.Config.Auth.RFC2136.KeySecret,
+		}
+	case providers.List[providers.POWERDNS]:
+		a.Logger.Info().Msg("the detected provider is PowerDNS")
+		a.Provider = powerdns.PowerDNSProvider{
+			Endpoint: a.Config.Auth.PowerDNS.Endpoint,
+			APIKey:   a.Config.Auth.PowerDNS.APIKey,
+			ServerID: a.Config.Auth.PowerDNS.ServerID,
+			Zone:     a.Config.Auth.PowerDNS.Zone,
+			Notify:   a.Config.Auth.PowerDNS.Notify,
+			Rectify:  a.Config.Auth.PowerDNS.Rectify,
 		}
 	case providers.List[providers.NONE]:
 		a.Logger.Fatal().Err(errors.New("no provider detected")).
 			Msg("no provider detected based on the configuration. Are you sure you completed all the required fields?")
 	}
+	a.Provider = providers.WithTimeout(a.Provider, a.Config.CallTimeout())
+
+	// detect the HTTP challenge publisher, only needed for the certificate
+	// packs validated over HTTP
+	switch publishers.PublisherToUse(*a.Config) {
+	case publishers.List[publishers.FILE]:
+		a.Logger.Info().Msg("the detected HTTP challenge publisher is a file tree")
+		a.Publisher = file.FilePublisher{
+			Root: a.Config.HTTPChallenge.File.Root,
+		}
+	case publishers.List[publishers.S3]:
+		a.Logger.Info().Msg("the detected HTTP challenge publisher is an S3 bucket")
+		a.Publisher = s3.S3Publisher{
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     a.Config.Auth.S3.AccessKeyID,
+				SecretAccessKey: a.Config.Auth.S3.SecretAccessKey,
+			},
+			Endpoint: a.Config.HTTPChallenge.S3.Endpoint,
+			Region:   a.Config.HTTPChallenge.S3.Region,
+			Bucket:   a.Config.HTTPChallenge.S3.Bucket,
+			Prefix:   a.Config.HTTPChallenge.S3.Prefix,
+		}
+	case publishers.List[publishers.SERVER]:
+		srv := server.Init(a.Config.HTTPChallenge.Server.Address, a.Config.HTTPChallenge.Server.Port)
+		a.Logger.Info().Msgf("the detected HTTP challenge publisher is an embedded server, starting it on address '%s'", srv.Addr)
+		go func() {
+			if err := srv.Start(); err != nil {
+				a.Logger.Fatal().Err(err).Msgf("HTTP challenge server failed to start")
+			}
+		}()
+		a.Publisher = srv
+	case publishers.List[publishers.NONE]:
+		a.Logger.Debug().Msg("no HTTP challenge publisher configured")
+	}
+
+	cache, err := cloudflare.NewCache(a.Config.Cloudflare.Cache.Path)
+	if err != nil {
+		a.Logger.Fatal().Err(err).Msgf("cannot load cache file %s", a.Config.Cloudflare.Cache.Path)
+	}
+
+	a.CloudflareCache = cache
+
+	ua := cloudflare.DefaultUserAgent + "/" + Version
+	if a.Config.Cloudflare.UserAgent != "" {
+		ua = a.Config.Cloudflare.UserAgent
+	}
+	a.Cloudflare = make(map[string]*cloudflare.Client)
+	for name, acc := range a.Config.CloudflareAccounts() {
+		a.Cloudflare[name] = cloudflare.NewClient(cloudflare.Credentials{
+			Token:  acc.Token,
+			Email:  acc.Email,
+			APIKey: acc.APIKey,
+		}).
+			WithAccountID(acc.Account.ID).
+			WithBaseURL(a.Config.Cloudflare.BaseURL).
+			WithTimeout(a.Config.Cloudflare.Timeout).
+			WithCallTimeout(a.Config.CallTimeout()).
+			WithUserAgent(ua).
+			WithPerPage(a.Config.Cloudflare.PerPage).
+			WithRetryPolicy(cloudflare.RetryPolicy{
+				MaxAttempts: a.Config.Cloudflare.Retry.MaxAttempts,
+				MinBackoff:  a.Config.Cloudflare.Retry.MinBackoff,
+				MaxBackoff:  a.Config.Cloudflare.Retry.MaxBackoff,
+				Jitter:      a.Config.Cloudflare.Retry.Jitter,
+			}).
+			WithRateLimit(a.Config.Cloudflare.RateLimit.RequestsPerSecond, a.Config.Cloudflare.RateLimit.Burst).
+			WithCache(cache, a.Config.Cloudflare.Cache.ZoneTTL, a.Config.Cloudflare.Cache.PackTTL)
+	}
+	a.Logger.Info().Msgf("%d Cloudflare accounts configured", len(a.Cloudflare))
+
+	// SIGINT and SIGTERM cancel ctx, which interrupts the calls in flight
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// misconfigured credentials are better caught now than in the middle of a
+	// run
+	if err := a.CheckCloudflareAccess(ctx); err != nil {
+		a.Logger.Fatal().Err(err).Msg("cloudflare access check failed")
+	}
 
-	a.CloudflareCredz = cloudflare.Credentials{
-		Token: a.Config.Auth.Cloudflare.Token,
+	if command == migrateDCVCommand {
+		if err := a.MigrateDCV(ctx, dryRun); err != nil {
+			a.Logger.Fatal().Err(err).Msg("DCV delegation failed")
+		}
+		return
 	}
 
 	// wait and loop
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	for {
 		select {
-		// having this pattern allows us to not interrupt the routine execution
-		// with an interrupt signal
-		// is it a good idea? maybe a more granular protection could be better
-		case sig := <-sigs:
-			a.Logger.Warn().Msgf("received signal %s, exiting", sig.String())
+		case <-ctx.Done():
+			a.Logger.Warn().Msg("received signal, exiting")
 			os.Exit(1)
 		case t := <-ticker.C:
-			if err := a.Run(t, dryRun); err != nil {
+			err := a.Run(ctx, t, dryRun)
+			if errors.Is(err, context.Canceled) {
+				a.Logger.Warn().Msg("received signal, run interrupted, exiting")
+				os.Exit(1)
+			}
+			if err != nil {
 				a.Logger.Fatal().Msgf("error running app: %s", err)
 			}
 			if runOnce {
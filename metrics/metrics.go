@@ -13,6 +13,10 @@ type Server struct {
 	Addr         string
 	NumOfDomains prometheus.Gauge
 	LastUpdated  *prometheus.GaugeVec
+	Expiry       *prometheus.GaugeVec
+	// CustomHostnameStatus is set to 1 for the current SSL status of each
+	// custom hostname
+	CustomHostnameStatus *prometheus.GaugeVec
 }
 
 // Init initialize the metrics server
@@ -26,6 +30,14 @@ func Init(addr, port string) *Server {
 			Name: "cfcr_last_updated_timestamp",
 			Help: "Last time the domain's TXT records have been updated.",
 		}, []string{"domain"}),
+		Expiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cfcr_certificate_expiry_timestamp",
+			Help: "Expiry date of the first certificate to expire in the certificate pack.",
+		}, []string{"domain", "pack"}),
+		CustomHostnameStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cfcr_custom_hostname_status",
+			Help: "Current SSL status of the custom hostname, set to 1.",
+		}, []string{"hostname", "status"}),
 	}
 
 	s.Addr = addr + ":" + port
@@ -33,6 +45,8 @@ func Init(addr, port string) *Server {
 	prometheus.MustRegister(
 		s.NumOfDomains,
 		s.LastUpdated,
+		s.Expiry,
+		s.CustomHostnameStatus,
 	)
 	return &s
 }
@@ -55,3 +69,14 @@ func (s *Server) SetNumOfDomainsMetric(num int) {
 func (s *Server) SetDomainLastUpdatedMetric(d string) {
 	s.LastUpdated.WithLabelValues(d).SetToCurrentTime()
 }
+
+func (s *Server) SetCertificateExpiryMetric(d, pack string, t time.Time) {
+	s.Expiry.WithLabelValues(d, pack).Set(float64(t.Unix()))
+}
+
+func (s *Server) SetCustomHostnameStatusMetric(h, previous, status string) {
+	if previous != "" {
+		s.CustomHostnameStatus.DeleteLabelValues(h, previous)
+	}
+	s.CustomHostnameStatus.WithLabelValues(h, status).Set(1)
+}
@@ -0,0 +1,298 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/azureauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultTTL is the TTL of the TXT record sets created by the provider
+	DefaultTTL = 60
+
+	apiVersion = "2018-05-01"
+)
+
+// errNotFound is returned by send when Azure answers with HTTP 404
+var errNotFound = errors.New("not found")
+
+// AzureProvider is a struct that implements the DelegationProvider interface.
+// All the values of a record name are kept in a single TXT record set, named
+// after the record name relative to its zone.
+type AzureProvider struct {
+	Tokens         *azureauth.TokenSource
+	SubscriptionID string
+	ResourceGroup  string
+	// Zone is the name of the DNS zone holding the records. If not set, the
+	// zone is looked up among the zones of the resource group.
+	Zone string
+	TTL  int
+
+	Client *http.Client
+}
+
+type txtRecord struct {
+	Value []string `json:"value"`
+}
+
+type cnameRecord struct {
+	CNAME string `json:"cname"`
+}
+
+type recordSet struct {
+	Properties struct {
+		TTL         int          `json:"TTL"`
+		TXTRecords  []txtRecord  `json:"TXTRecords,omitempty"`
+		CNAMERecord *cnameRecord `json:"CNAMERecord,omitempty"`
+	} `json:"properties"`
+}
+
+// values returns the TXT values of the record set, joining the chunks of the
+// long ones
+func (s recordSet) values() []string {
+	var ret []string
+	for _, r := range s.Properties.TXTRecords {
+		ret = append(ret, strings.Join(r.Value, ""))
+	}
+	return ret
+}
+
+// CreateTXTRecords replaces the TXT record sets of records by ones holding
+// both the existing and the new values.
+func (p AzureProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	for name, values := range providers.GroupByName(records) {
+		path, err := p.recordSetPath(ctx, l, name, "TXT")
+		if err != nil {
+			return err
+		}
+
+		existing, err := p.getValues(ctx, l, path)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if !providers.Contains(existing, v) {
+				existing = append(existing, v)
+			}
+		}
+
+		var set recordSet
+		set.Properties.TTL = p.TTL
+		if set.Properties.TTL == 0 {
+			set.Properties.TTL = DefaultTTL
+		}
+		for _, v := range existing {
+			set.Properties.TXTRecords = append(set.Properties.TXTRecords, txtRecord{Value: []string{v}})
+		}
+
+		l.Info().Msgf("setting %d values in %s TXT record set on Azure API", len(existing), name)
+		if err := p.send(ctx, "PUT", path, set, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanTXTRecords deletes the TXT record set of name.
+func (p AzureProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	path, err := p.recordSetPath(ctx, l, name, "TXT")
+	if err != nil {
+		return err
+	}
+
+	// deleting a record set that does not exist is not an error
+	l.Info().Msgf("deleting %s TXT record set on Azure API", name)
+	return p.send(ctx, "DELETE", path, nil, nil)
+}
+
+// CheckIfRecordsAlreadyExist returns true if every record is set with its
+// value.
+func (p AzureProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	for name, values := range providers.GroupByName(records) {
+		path, err := p.recordSetPath(ctx, l, name, "TXT")
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := p.getValues(ctx, l, path)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if !providers.Contains(existing, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// CreateDelegationRecord replaces the CNAME record set of name by one pointing
+// at target.
+func (p AzureProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	path, err := p.recordSetPath(ctx, l, name, "CNAME")
+	if err != nil {
+		return err
+	}
+
+	var set recordSet
+	set.Properties.TTL = p.TTL
+	if set.Properties.TTL == 0 {
+		set.Properties.TTL = DefaultTTL
+	}
+	set.Properties.CNAMERecord = &cnameRecord{CNAME: strings.TrimSuffix(target, ".")}
+
+	l.Info().Msgf("setting %s CNAME record set on Azure API", name)
+	return p.send(ctx, "PUT", path, set, nil)
+}
+
+// getValues returns the values of the TXT record set at path, or nil if
+// there is none
+func (p AzureProvider) getValues(ctx context.Context, l zerolog.Logger, path string) ([]string, error) {
+	var set recordSet
+	l.Debug().Msgf("sending GET on %s", path)
+	err := p.send(ctx, "GET", path, nil, &set)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return set.values(), nil
+}
+
+// recordSetPath returns the path of the record set of name of type typ
+func (p AzureProvider) recordSetPath(ctx context.Context, l zerolog.Logger, name, typ string) (string, error) {
+	zone := p.Zone
+	if zone == "" {
+		var err error
+		if zone, err = p.lookupZone(ctx, l, name); err != nil {
+			return "", err
+		}
+	}
+
+	relative, err := relativeName(name, zone)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", p.zonesPath(), zone, typ, relative), nil
+}
+
+// lookupZone returns the zone of the resource group holding name, that is
+// the longest one name belongs to
+func (p AzureProvider) lookupZone(ctx context.Context, l zerolog.Logger, name string) (string, error) {
+	type APISchema struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+		NextLink string `json:"nextLink"`
+	}
+
+	name = strings.TrimSuffix(name, ".")
+	var ret string
+	path := p.zonesPath()
+	for path != "" {
+		var a APISchema
+		l.Debug().Msgf("sending GET on %s", path)
+		if err := p.send(ctx, "GET", path, nil, &a); err != nil {
+			return "", err
+		}
+		for _, z := range a.Value {
+			if (name == z.Name || strings.HasSuffix(name, "."+z.Name)) && len(z.Name) > len(ret) {
+				ret = z.Name
+			}
+		}
+		path = a.NextLink
+	}
+
+	if ret == "" {
+		return "", fmt.Errorf("no Azure DNS zone of resource group %s holds %s", p.ResourceGroup, name)
+	}
+	return ret, nil
+}
+
+func (p AzureProvider) zonesPath() string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones",
+		p.SubscriptionID, p.ResourceGroup)
+}
+
+// send sends an authenticated request on path, with body encoded in JSON if
+// not nil, and decodes the JSON response in v if not nil. path is either
+// relative to the resource manager endpoint or a link returned by Azure.
+func (p AzureProvider) send(ctx context.Context, method, path string, body, v interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	rawurl := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		rawurl = strings.TrimSuffix(p.Tokens.Resource(), "/") + path + "?api-version=" + apiVersion
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := p.Tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get Azure access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if r.StatusCode >= 300 {
+		return fmt.Errorf("azure returned HTTP %d on %s %s: %s", r.StatusCode, method, path, data)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// relativeName returns the name of the record set of the fully-qualified name
+// in zone, as expected by Azure API: "@" for the zone apex
+func relativeName(name, zone string) (string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == zone {
+		return "@", nil
+	}
+	if !strings.HasSuffix(name, "."+zone) {
+		return "", fmt.Errorf("%s is not part of the zone %s", name, zone)
+	}
+	return strings.TrimSuffix(name, "."+zone), nil
+}
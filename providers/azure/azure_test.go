@@ -0,0 +1,166 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/govirtuo/cfcr/azureauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+// fakeAzureDNS is a minimal Azure DNS stand-in with two zones listed over two
+// pages, also serving the token endpoint
+type fakeAzureDNS struct {
+	mu   sync.Mutex
+	url  string
+	sets map[string]recordSet
+}
+
+func (f *fakeAzureDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/tenant/oauth2/token" {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":"3599"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const zones = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/dnsZones"
+	switch {
+	case r.Method == "GET" && r.URL.Path == zones && r.URL.Query().Get("page") == "":
+		fmt.Fprintf(w, `{"value":[{"name":"bar.com"}],"nextLink":"%s%s?page=2"}`, f.url, zones)
+	case r.Method == "GET" && r.URL.Path == zones:
+		fmt.Fprint(w, `{"value":[{"name":"www.bar.com"}]}`)
+	case strings.HasPrefix(r.URL.Path, zones+"/"):
+		if r.URL.Query().Get("api-version") != apiVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, zones+"/")
+		switch r.Method {
+		case "GET":
+			s, ok := f.sets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(s)
+		case "PUT":
+			var s recordSet
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.sets[key] = s
+			json.NewEncoder(w).Encode(s)
+		case "DELETE":
+			delete(f.sets, key)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAzureProvider(t *testing.T) {
+	fake := &fakeAzureDNS{sets: make(map[string]recordSet)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.url = srv.URL
+
+	p := AzureProvider{
+		Tokens: azureauth.NewTokenSource(azureauth.ClientCredentials{
+			TenantID:     "tenant",
+			ClientID:     "id",
+			ClientSecret: "secret",
+			Authority:    srv.URL,
+			Resource:     srv.URL,
+		}),
+		SubscriptionID: "sub",
+		ResourceGroup:  "rg",
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	first := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	second := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "def"}
+	apex := providers.Record{Name: "_acme-challenge.bar.com", Value: "ghi"}
+	if err := p.CreateTXTRecords(ctx, l, first, apex); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if err := p.CreateTXTRecords(ctx, l, second); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	// the record of www.bar.com belongs to the longest matching zone
+	got := fake.sets["www.bar.com/TXT/_acme-challenge"].values()
+	sort.Strings(got)
+	if want := "[abc def]"; fmt.Sprint(got) != want {
+		t.Errorf("got values '%v', want '%v'", got, want)
+	}
+	if got := fake.sets["bar.com/TXT/_acme-challenge"].Properties.TTL; got != DefaultTTL {
+		t.Errorf("got TTL %d, want %d", got, DefaultTTL)
+	}
+
+	ok, err := p.CheckIfRecordsAlreadyExist(ctx, l, first, second, apex)
+	if err != nil || !ok {
+		t.Errorf("got '%v' and error '%v', want true", ok, err)
+	}
+	ok, err = p.CheckIfRecordsAlreadyExist(ctx, l, providers.Record{Name: "_acme-challenge.blog.bar.com", Value: "abc"})
+	if err != nil || ok {
+		t.Errorf("got '%v' and error '%v', want false", ok, err)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if _, ok := fake.sets["www.bar.com/TXT/_acme-challenge"]; ok || len(fake.sets) != 1 {
+		t.Errorf("got record sets '%v' after cleaning", fake.sets)
+	}
+
+	if err := p.CreateDelegationRecord(ctx, l, "_acme-challenge.www.bar.com", "www.bar.com.uuid.dcv.cloudflare.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if got := fake.sets["www.bar.com/CNAME/_acme-challenge"].Properties.CNAMERecord; got == nil || got.CNAME != "www.bar.com.uuid.dcv.cloudflare.com" {
+		t.Errorf("got CNAME record '%v'", got)
+	}
+
+	if _, err := p.recordSetPath(ctx, l, "_acme-challenge.baz.org", "TXT"); err == nil || !strings.Contains(err.Error(), "no Azure DNS zone") {
+		t.Errorf("got error '%v' for a missing zone", err)
+	}
+}
+
+func Test_relativeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "bar.com", want: "@"},
+		{name: "_acme-challenge.bar.com", want: "_acme-challenge"},
+		{name: "_acme-challenge.www.bar.com.", want: "_acme-challenge.www"},
+		{name: "_acme-challenge.foobar.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := relativeName(tt.name, "bar.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error '%v', wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package gcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/gcpauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultEndpoint is the root of Cloud DNS v1 API
+	DefaultEndpoint = "https://dns.googleapis.com/dns/v1"
+	// Scope is the OAuth 2.0 scope needed to manage the records
+	Scope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+	// DefaultTTL is the TTL of the TXT rrsets created by the provider
+	DefaultTTL = 60
+	// DefaultPollInterval is the interval between two checks of the status
+	// of a change
+	DefaultPollInterval = 2 * time.Second
+)
+
+// GCloudProvider is a struct that implements the DelegationProvider interface.
+// All the values of a record name are kept in a single TXT rrset, replaced by
+// change requests that are waited for until they are done.
+type GCloudProvider struct {
+	Tokens  *gcpauth.TokenSource
+	Project string
+	// ManagedZone is the name of the managed zone holding the records. If
+	// not set, the managed zone is looked up from the record names.
+	ManagedZone  string
+	Endpoint     string
+	TTL          int
+	PollInterval time.Duration
+
+	Client *http.Client
+}
+
+type rrset struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Rrdatas []string `json:"rrdatas"`
+}
+
+type change struct {
+	ID        string  `json:"id,omitempty"`
+	Status    string  `json:"status,omitempty"`
+	Additions []rrset `json:"additions,omitempty"`
+	Deletions []rrset `json:"deletions,omitempty"`
+}
+
+// values returns the unquoted TXT values of the rrset, if any
+func (s *rrset) values() []string {
+	if s == nil {
+		return nil
+	}
+	var ret []string
+	for _, v := range s.Rrdatas {
+		ret = append(ret, strings.Trim(v, `"`))
+	}
+	return ret
+}
+
+// CreateTXTRecords replaces the TXT rrsets of records by ones holding both
+// the existing and the new values.
+func (p GCloudProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	for name, values := range providers.GroupByName(records) {
+		zone, err := p.managedZone(ctx, l, name)
+		if err != nil {
+			return err
+		}
+
+		existing, err := p.getRRSet(ctx, l, zone, name, "TXT")
+		if err != nil {
+			return err
+		}
+		merged := existing.values()
+		for _, v := range values {
+			if !providers.Contains(merged, v) {
+				merged = append(merged, v)
+			}
+		}
+
+		ttl := p.TTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		addition := rrset{Name: providers.FQDN(name), Type: "TXT", TTL: ttl}
+		for _, v := range merged {
+			addition.Rrdatas = append(addition.Rrdatas, `"`+v+`"`)
+		}
+
+		// an rrset cannot be updated in place, the existing one is deleted
+		// in the same change
+		c := change{Additions: []rrset{addition}}
+		if existing != nil {
+			c.Deletions = []rrset{*existing}
+		}
+		l.Info().Msgf("setting %d values in %s TXT rrset on Cloud DNS API", len(merged), name)
+		if err := p.change(ctx, l, zone, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanTXTRecords deletes the TXT rrset of name.
+func (p GCloudProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	zone, err := p.managedZone(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.getRRSet(ctx, l, zone, name, "TXT")
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		l.Info().Msg("nothing to clean")
+		return nil
+	}
+
+	l.Info().Msgf("deleting %s TXT rrset on Cloud DNS API", name)
+	return p.change(ctx, l, zone, change{Deletions: []rrset{*existing}})
+}
+
+// CheckIfRecordsAlreadyExist returns true if every record is set with its
+// value.
+func (p GCloudProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	for name, values := range providers.GroupByName(records) {
+		zone, err := p.managedZone(ctx, l, name)
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := p.getRRSet(ctx, l, zone, name, "TXT")
+		if err != nil {
+			return false, err
+		}
+		got := existing.values()
+		for _, v := range values {
+			if !providers.Contains(got, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// CreateDelegationRecord replaces the CNAME rrset of name by one pointing at
+// target.
+func (p GCloudProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	zone, err := p.managedZone(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.getRRSet(ctx, l, zone, name, "CNAME")
+	if err != nil {
+		return err
+	}
+
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	c := change{Additions: []rrset{{Name: providers.FQDN(name), Type: "CNAME", TTL: ttl, Rrdatas: []string{providers.FQDN(target)}}}}
+	if existing != nil {
+		c.Deletions = []rrset{*existing}
+	}
+	l.Info().Msgf("setting %s CNAME rrset on Cloud DNS API", name)
+	return p.change(ctx, l, zone, c)
+}
+
+// managedZone returns the name of the managed zone holding name, walking up
+// its labels until a managed zone is found
+func (p GCloudProvider) managedZone(ctx context.Context, l zerolog.Logger, name string) (string, error) {
+	if p.ManagedZone != "" {
+		return p.ManagedZone, nil
+	}
+
+	type APISchema struct {
+		ManagedZones []struct {
+			Name    string `json:"name"`
+			DNSName string `json:"dnsName"`
+		} `json:"managedZones"`
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		candidate := providers.FQDN(strings.Join(labels[i:], "."))
+		q := url.Values{"dnsName": {candidate}}
+
+		var a APISchema
+		l.Debug().Msgf("looking up managed zone %s on Cloud DNS API", candidate)
+		if err := p.send(ctx, "GET", "/managedZones?"+q.Encode(), nil, &a); err != nil {
+			return "", err
+		}
+		for _, z := range a.ManagedZones {
+			if z.DNSName == candidate {
+				return z.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no Cloud DNS managed zone found for %s", name)
+}
+
+// getRRSet returns the rrset of name of type typ, or nil if there is none
+func (p GCloudProvider) getRRSet(ctx context.Context, l zerolog.Logger, zone, name, typ string) (*rrset, error) {
+	type APISchema struct {
+		RRSets []rrset `json:"rrsets"`
+	}
+
+	q := url.Values{"name": {providers.FQDN(name)}, "type": {typ}}
+	var a APISchema
+	l.Debug().Msgf("getting %s %s rrset on Cloud DNS API", name, typ)
+	if err := p.send(ctx, "GET", "/managedZones/"+zone+"/rrsets?"+q.Encode(), nil, &a); err != nil {
+		return nil, err
+	}
+	if len(a.RRSets) == 0 {
+		return nil, nil
+	}
+	return &a.RRSets[0], nil
+}
+
+// change sends the change c and waits for it to be done
+func (p GCloudProvider) change(ctx context.Context, l zerolog.Logger, zone string, c change) error {
+	var res change
+	if err := p.send(ctx, "POST", "/managedZones/"+zone+"/changes", c, &res); err != nil {
+		return err
+	}
+
+	interval := p.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	for res.Status != "done" {
+		l.Debug().Msgf("change %s is %s, waiting", res.ID, res.Status)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("change %s is still %s: %w", res.ID, res.Status, ctx.Err())
+		case <-time.After(interval):
+		}
+
+		if err := p.send(ctx, "GET", "/managedZones/"+zone+"/changes/"+res.ID, nil, &res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends an authenticated request on path, relative to the project, with
+// body encoded in JSON if not nil, and decodes the JSON response in v
+func (p GCloudProvider) send(ctx context.Context, method, path string, body, v interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	rawurl := strings.TrimSuffix(endpoint, "/") + "/projects/" + p.Project + path
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := p.Tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get Google Cloud access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= 300 {
+		return fmt.Errorf("cloud DNS returned HTTP %d on %s %s: %s", r.StatusCode, method, path, data)
+	}
+	return json.Unmarshal(data, v)
+}
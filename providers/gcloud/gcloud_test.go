@@ -0,0 +1,174 @@
+package gcloud
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/govirtuo/cfcr/gcpauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+// fakeCloudDNS is a minimal Cloud DNS stand-in with a single managed zone,
+// also serving the OAuth 2.0 token endpoint. The rrsets are keyed by name and
+// type.
+type fakeCloudDNS struct {
+	mu      sync.Mutex
+	rrsets  map[string]rrset
+	changes map[string]int
+}
+
+func (f *fakeCloudDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const prefix = "/projects/project"
+	q := r.URL.Query()
+	switch {
+	case r.Method == "GET" && r.URL.Path == prefix+"/managedZones":
+		var zones []map[string]string
+		if q.Get("dnsName") == "bar.com." {
+			zones = append(zones, map[string]string{"name": "bar-com", "dnsName": "bar.com."})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"managedZones": zones})
+	case r.Method == "GET" && r.URL.Path == prefix+"/managedZones/bar-com/rrsets":
+		var sets []rrset
+		if s, ok := f.rrsets[q.Get("name")+" "+q.Get("type")]; ok {
+			sets = append(sets, s)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"rrsets": sets})
+	case r.Method == "POST" && r.URL.Path == prefix+"/managedZones/bar-com/changes":
+		var c change
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, d := range c.Deletions {
+			if fmt.Sprint(f.rrsets[d.Name+" "+d.Type]) != fmt.Sprint(d) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			delete(f.rrsets, d.Name+" "+d.Type)
+		}
+		for _, a := range c.Additions {
+			if _, ok := f.rrsets[a.Name+" "+a.Type]; ok {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			f.rrsets[a.Name+" "+a.Type] = a
+		}
+		f.changes["1"] = 0
+		fmt.Fprint(w, `{"id":"1","status":"pending"}`)
+	case r.Method == "GET" && r.URL.Path == prefix+"/managedZones/bar-com/changes/1":
+		// the change is done on the second poll
+		f.changes["1"]++
+		status := "pending"
+		if f.changes["1"] > 1 {
+			status = "done"
+		}
+		fmt.Fprintf(w, `{"id":"1","status":"%s"}`, status)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTokenSource(t *testing.T, tokenURI string) *gcpauth.TokenSource {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	ts, err := gcpauth.NewTokenSource(gcpauth.ServiceAccount{
+		ClientEmail: "cfcr@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    tokenURI,
+	}, Scope)
+	if err != nil {
+		t.Fatalf("cannot create token source: %v", err)
+	}
+	return ts
+}
+
+func TestGCloudProvider(t *testing.T) {
+	fake := &fakeCloudDNS{rrsets: make(map[string]rrset), changes: make(map[string]int)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := GCloudProvider{
+		Tokens:       newTokenSource(t, srv.URL+"/token"),
+		Project:      "project",
+		Endpoint:     srv.URL,
+		PollInterval: time.Millisecond,
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	first := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	second := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "def"}
+	if err := p.CreateTXTRecords(ctx, l, first); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if err := p.CreateTXTRecords(ctx, l, second); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	got := fake.rrsets["_acme-challenge.www.bar.com. TXT"].Rrdatas
+	sort.Strings(got)
+	if want := `["abc" "def"]`; fmt.Sprint(got) != want {
+		t.Errorf("got rrdatas '%v', want '%v'", got, want)
+	}
+	if fake.changes["1"] != 2 {
+		t.Errorf("got %d change polls, want 2", fake.changes["1"])
+	}
+
+	ok, err := p.CheckIfRecordsAlreadyExist(ctx, l, first, second)
+	if err != nil || !ok {
+		t.Errorf("got '%v' and error '%v', want true", ok, err)
+	}
+	ok, err = p.CheckIfRecordsAlreadyExist(ctx, l, providers.Record{Name: "_acme-challenge.bar.com", Value: "abc"})
+	if err != nil || ok {
+		t.Errorf("got '%v' and error '%v', want false", ok, err)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(fake.rrsets) != 0 {
+		t.Errorf("got rrsets '%v' after cleaning", fake.rrsets)
+	}
+
+	// the CNAME rrset is replaced if it already exists
+	for _, target := range []string{"www.bar.com.old.dcv.cloudflare.com", "www.bar.com.uuid.dcv.cloudflare.com"} {
+		if err := p.CreateDelegationRecord(ctx, l, "_acme-challenge.www.bar.com", target); err != nil {
+			t.Fatalf("got error '%v'", err)
+		}
+	}
+	if got := fake.rrsets["_acme-challenge.www.bar.com. CNAME"].Rrdatas; fmt.Sprint(got) != "[www.bar.com.uuid.dcv.cloudflare.com.]" {
+		t.Errorf("got CNAME rrdatas '%v'", got)
+	}
+
+	if _, err := p.managedZone(ctx, l, "_acme-challenge.baz.org"); err == nil || !strings.Contains(err.Error(), "no Cloud DNS managed zone") {
+		t.Errorf("got error '%v' for a missing managed zone", err)
+	}
+}
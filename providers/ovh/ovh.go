@@ -1,10 +1,12 @@
 package ovh
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/govirtuo/cfcr/providers"
 	"github.com/ovh/go-ovh/ovh"
 	"github.com/rs/zerolog"
 )
@@ -13,7 +15,6 @@ import (
 type OVHProvider struct {
 	Credentials Credentials
 	BaseDomain  string
-	Subdomain   string
 }
 
 // Set of credentials required to request OVH API
@@ -23,7 +24,9 @@ type Credentials struct {
 	ConsumerKey       string
 }
 
-func getDomainIDs(l zerolog.Logger, basedomain, subdomain string, credz Credentials) ([]string, error) {
+// getDomainIDs returns the IDs of the records of subdomain. If fieldType is
+// not empty, only the records of this type are returned.
+func getDomainIDs(ctx context.Context, l zerolog.Logger, basedomain, subdomain, fieldType string, credz Credentials) ([]string, error) {
 	type APISchema []int
 
 	client, err := ovh.NewClient(
@@ -38,8 +41,11 @@ func getDomainIDs(l zerolog.Logger, basedomain, subdomain string, credz Credenti
 
 	var a APISchema
 	uri := fmt.Sprintf("/domain/zone/%s/record?subDomain=%s", basedomain, subdomain)
+	if fieldType != "" {
+		uri += "&fieldType=" + fieldType
+	}
 	l.Debug().Msgf("sending GET on %s", uri)
-	if err := client.Get(uri, &a); err != nil {
+	if err := client.GetWithContext(ctx, uri, &a); err != nil {
 		return []string{}, err
 	}
 
@@ -50,24 +56,27 @@ func getDomainIDs(l zerolog.Logger, basedomain, subdomain string, credz Credenti
 	return ret, nil
 }
 
-func getCorrectSubdomain(d, bd string) string {
-	// this should do the following
-	//   domain: foobar.com -> subdomain: _acme-challenge
-	//   domain: www.foobar.com -> subdomain: _acme-challenge.www
-	//   domain: www.staging.foobar.com -> subdomain: _acme-challenge.www.staging
-	//
-	// tests in ovh_test.go serves as a proof
-	subdomain := "_acme-challenge"
-	if d != bd {
-		subdomain = strings.TrimSuffix("_acme-challenge."+d, "."+bd)
-	}
-	return subdomain
+// relativeName returns the subdomain of the fully-qualified name in the zone
+// bd, as expected by OVH API:
+//
+//	name: _acme-challenge.foobar.com -> subdomain: _acme-challenge
+//	name: _acme-challenge.www.foobar.com -> subdomain: _acme-challenge.www
+//
+// tests in ovh_test.go serves as a proof
+func relativeName(name, bd string) (string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == bd {
+		return "", nil
+	}
+	if !strings.HasSuffix(name, "."+bd) {
+		return "", fmt.Errorf("%s is not part of the zone %s", name, bd)
+	}
+	return strings.TrimSuffix(name, "."+bd), nil
 }
 
-// CreateTXTRecords creates TXT records with the content of txtvalues.
-func (p OVHProvider) CreateTXTRecords(l zerolog.Logger, domain string, txtvalues ...string) error {
-	subdomain := getCorrectSubdomain(domain, p.BaseDomain)
-
+// CreateTXTRecords creates TXT records with the content of records. The
+// values already set are skipped, so that no record is duplicated.
+func (p OVHProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
 	client, err := ovh.NewClient(
 		"ovh-eu",
 		p.Credentials.ApplicationKey,
@@ -84,26 +93,46 @@ func (p OVHProvider) CreateTXTRecords(l zerolog.Logger, domain string, txtvalues
 		Target    string `json:"target"`
 	}
 
-	for _, v := range txtvalues {
-		params := CreatePostParams{
-			SubDomain: subdomain,
-			FieldType: "TXT",
-			Target:    v,
+	for name, values := range providers.GroupByName(records) {
+		subdomain, err := relativeName(name, p.BaseDomain)
+		if err != nil {
+			return err
 		}
-		uri := fmt.Sprintf("/domain/zone/%s/record", p.BaseDomain)
-		l.Debug().Msgf("sending POST on %s with params %v", uri, params)
-		if err := client.Post(uri, params, nil); err != nil {
+		existing, err := p.getTXTValues(ctx, l, client, subdomain)
+		if err != nil {
 			return err
 		}
+
+		for _, v := range values {
+			if existing[v] {
+				l.Debug().Msgf("TXT record %s %s already exists, skipping", name, v)
+				continue
+			}
+			existing[v] = true
+
+			params := CreatePostParams{
+				SubDomain: subdomain,
+				FieldType: "TXT",
+				Target:    v,
+			}
+			uri := fmt.Sprintf("/domain/zone/%s/record", p.BaseDomain)
+			l.Debug().Msgf("sending POST on %s with params %v", uri, params)
+			if err := client.PostWithContext(ctx, uri, params, nil); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-// CleanTXTRecords removes all _acme-challenge.domain TXT records.
-func (p OVHProvider) CleanTXTRecords(l zerolog.Logger, domain string) error {
-	subdomain := getCorrectSubdomain(domain, p.BaseDomain)
+// CleanTXTRecords removes all the TXT records of name.
+func (p OVHProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	subdomain, err := relativeName(name, p.BaseDomain)
+	if err != nil {
+		return err
+	}
 	l.Info().Msgf("getting IDs for %s TXT records on OVH API", subdomain)
-	ids, err := getDomainIDs(l, p.BaseDomain, subdomain, p.Credentials)
+	ids, err := getDomainIDs(ctx, l, p.BaseDomain, subdomain, "TXT", p.Credentials)
 	if err != nil {
 		return err
 	}
@@ -126,7 +155,7 @@ func (p OVHProvider) CleanTXTRecords(l zerolog.Logger, domain string) error {
 	for _, id := range ids {
 		uri := fmt.Sprintf("/domain/zone/%s/record/%s", p.BaseDomain, id)
 		l.Debug().Msgf("sending DELETE on %s", uri)
-		if err := client.Delete(uri, nil); err != nil {
+		if err := client.DeleteWithContext(ctx, uri, nil); err != nil {
 			return err
 		}
 	}
@@ -134,13 +163,107 @@ func (p OVHProvider) CleanTXTRecords(l zerolog.Logger, domain string) error {
 	return nil
 }
 
-func (p OVHProvider) CheckIfRecordsAlreadyExist(l zerolog.Logger, domain string) (bool, error) {
-	subdomain := getCorrectSubdomain(domain, p.BaseDomain)
-	l.Info().Msgf("getting IDs for %s TXT records on OVH API", subdomain)
-	ids, err := getDomainIDs(l, p.BaseDomain, subdomain, p.Credentials)
+// CheckIfRecordsAlreadyExist returns true if every record is set with its
+// value.
+func (p OVHProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	client, err := ovh.NewClient(
+		"ovh-eu",
+		p.Credentials.ApplicationKey,
+		p.Credentials.ApplicationSecret,
+		p.Credentials.ConsumerKey,
+	)
 	if err != nil {
 		return false, err
 	}
 
-	return len(ids) != 0, nil
+	for name, values := range providers.GroupByName(records) {
+		subdomain, err := relativeName(name, p.BaseDomain)
+		if err != nil {
+			return false, err
+		}
+		existing, err := p.getTXTValues(ctx, l, client, subdomain)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if !existing[v] {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// getTXTValues returns the values of the TXT records of subdomain
+func (p OVHProvider) getTXTValues(ctx context.Context, l zerolog.Logger, client *ovh.Client, subdomain string) (map[string]bool, error) {
+	type APISchema struct {
+		Target string `json:"target"`
+	}
+
+	l.Info().Msgf("getting IDs for %s TXT records on OVH API", subdomain)
+	ids, err := getDomainIDs(ctx, l, p.BaseDomain, subdomain, "TXT", p.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]bool)
+	for _, id := range ids {
+		var a APISchema
+		uri := fmt.Sprintf("/domain/zone/%s/record/%s", p.BaseDomain, id)
+		l.Debug().Msgf("sending GET on %s", uri)
+		if err := client.GetWithContext(ctx, uri, &a); err != nil {
+			return nil, err
+		}
+		// OVH may return the TXT values quoted
+		ret[strings.Trim(a.Target, `"`)] = true
+	}
+	return ret, nil
+}
+
+// CreateDelegationRecord replaces the CNAME records of name by a single one
+// pointing at target.
+func (p OVHProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	subdomain, err := relativeName(name, p.BaseDomain)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("getting IDs for %s CNAME records on OVH API", subdomain)
+	ids, err := getDomainIDs(ctx, l, p.BaseDomain, subdomain, "CNAME", p.Credentials)
+	if err != nil {
+		return err
+	}
+
+	client, err := ovh.NewClient(
+		"ovh-eu",
+		p.Credentials.ApplicationKey,
+		p.Credentials.ApplicationSecret,
+		p.Credentials.ConsumerKey,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		uri := fmt.Sprintf("/domain/zone/%s/record/%s", p.BaseDomain, id)
+		l.Debug().Msgf("sending DELETE on %s", uri)
+		if err := client.DeleteWithContext(ctx, uri, nil); err != nil {
+			return err
+		}
+	}
+
+	type CreatePostParams struct {
+		SubDomain string `json:"subDomain"`
+		FieldType string `json:"fieldType"`
+		Target    string `json:"target"`
+	}
+
+	params := CreatePostParams{
+		SubDomain: subdomain,
+		FieldType: "CNAME",
+		// the target is fully qualified, otherwise OVH appends the zone to it
+		Target: providers.FQDN(target),
+	}
+	uri := fmt.Sprintf("/domain/zone/%s/record", p.BaseDomain)
+	l.Debug().Msgf("sending POST on %s with params %v", uri, params)
+	return client.PostWithContext(ctx, uri, params, nil)
 }
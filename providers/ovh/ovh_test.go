@@ -2,34 +2,57 @@ package ovh
 
 import "testing"
 
-func Test_getCorrectSubdomain(t *testing.T) {
+func Test_relativeName(t *testing.T) {
 	tests := []struct {
-		name  string
-		d, bd string
-		want  string
+		name     string
+		fqdn, bd string
+		want     string
+		wantErr  bool
 	}{
 		{
 			name: "root",
-			d:    "foobar.com",
+			fqdn: "foobar.com",
 			bd:   "foobar.com",
-			want: "_acme-challenge",
+			want: "",
 		},
 		{
 			name: "one level",
-			d:    "api.foobar.com",
+			fqdn: "_acme-challenge.foobar.com",
 			bd:   "foobar.com",
-			want: "_acme-challenge.api",
+			want: "_acme-challenge",
 		},
 		{
 			name: "two levels",
-			d:    "www.staging.foobar.com",
+			fqdn: "_acme-challenge.www.staging.foobar.com",
 			bd:   "foobar.com",
 			want: "_acme-challenge.www.staging",
 		},
+		{
+			name: "trailing dot",
+			fqdn: "_acme-challenge.api.foobar.com.",
+			bd:   "foobar.com",
+			want: "_acme-challenge.api",
+		},
+		{
+			name:    "other zone",
+			fqdn:    "_acme-challenge.barfoo.com",
+			bd:      "foobar.com",
+			wantErr: true,
+		},
+		{
+			name:    "suffix without dot",
+			fqdn:    "_acme-challenge.notfoobar.com",
+			bd:      "foobar.com",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := getCorrectSubdomain(tt.d, tt.bd); got != tt.want {
+			got, err := relativeName(tt.fqdn, tt.bd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error '%v', wantErr '%v'", err, tt.wantErr)
+			}
+			if got != tt.want {
 				t.Errorf("got '%v', want '%v'", got, tt.want)
 			}
 		})
@@ -0,0 +1,293 @@
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultServerID is the identifier of the server in PowerDNS API, which
+	// is always "localhost" for the Authoritative Server
+	DefaultServerID = "localhost"
+	// DefaultTTL is the TTL of the TXT rrsets created by the provider
+	DefaultTTL = 60
+)
+
+// PowerDNSProvider is a struct that implements the DelegationProvider
+// interface using the HTTP API of PowerDNS Authoritative Server. All the
+// values of a record name are kept in a single TXT rrset.
+type PowerDNSProvider struct {
+	// Endpoint is the base URL of the API, without the /api/v1 suffix
+	Endpoint string
+	APIKey   string
+	ServerID string
+	// Zone is the name of the zone holding the records. If not set, the zone
+	// is looked up among the zones of the server.
+	Zone string
+	TTL  int
+	// Notify sends a NOTIFY to the secondaries of the zone after each change
+	Notify bool
+	// Rectify rectifies the zone after each change, only needed for the
+	// DNSSEC-signed zones not rectified automatically
+	Rectify bool
+
+	Client *http.Client
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type rrset struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        int      `json:"ttl,omitempty"`
+	ChangeType string   `json:"changetype,omitempty"`
+	Records    []record `json:"records"`
+}
+
+// CreateTXTRecords replaces the TXT rrsets of records by ones holding both
+// the existing and the new values.
+func (p PowerDNSProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	for name, values := range providers.GroupByName(records) {
+		zone, err := p.zoneID(ctx, l, name)
+		if err != nil {
+			return err
+		}
+
+		merged, err := p.getValues(ctx, l, zone, name)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if !providers.Contains(merged, v) {
+				merged = append(merged, v)
+			}
+		}
+
+		ttl := p.TTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		replace := rrset{Name: providers.FQDN(name), Type: "TXT", TTL: ttl, ChangeType: "REPLACE"}
+		for _, v := range merged {
+			replace.Records = append(replace.Records, record{Content: `"` + v + `"`})
+		}
+
+		l.Info().Msgf("setting %d values in %s TXT rrset on PowerDNS API", len(merged), name)
+		if err := p.patch(ctx, l, zone, replace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanTXTRecords deletes the TXT rrset of name.
+func (p PowerDNSProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	zone, err := p.zoneID(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	// deleting a rrset that does not exist is not an error
+	l.Info().Msgf("deleting %s TXT rrset on PowerDNS API", name)
+	return p.patch(ctx, l, zone, rrset{Name: providers.FQDN(name), Type: "TXT", ChangeType: "DELETE"})
+}
+
+// CheckIfRecordsAlreadyExist returns true if every record is set with its
+// value.
+func (p PowerDNSProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	for name, values := range providers.GroupByName(records) {
+		zone, err := p.zoneID(ctx, l, name)
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := p.getValues(ctx, l, zone, name)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if !providers.Contains(existing, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// CreateDelegationRecord replaces the CNAME rrset of name by one pointing at
+// target.
+func (p PowerDNSProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	zone, err := p.zoneID(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	replace := rrset{
+		Name:       providers.FQDN(name),
+		Type:       "CNAME",
+		TTL:        ttl,
+		ChangeType: "REPLACE",
+		Records:    []record{{Content: providers.FQDN(target)}},
+	}
+
+	l.Info().Msgf("setting %s CNAME rrset on PowerDNS API", name)
+	return p.patch(ctx, l, zone, replace)
+}
+
+// getValues returns the unquoted values of the enabled records of the TXT
+// rrset of name, if any
+func (p PowerDNSProvider) getValues(ctx context.Context, l zerolog.Logger, zone, name string) ([]string, error) {
+	type APISchema struct {
+		RRsets []rrset `json:"rrsets"`
+	}
+
+	// the rrset filters are ignored by the versions older than 4.8, which
+	// return the whole zone
+	path := fmt.Sprintf("/zones/%s?rrset_name=%s&rrset_type=TXT", url.PathEscape(zone), url.QueryEscape(providers.FQDN(name)))
+	var a APISchema
+	l.Debug().Msgf("sending GET on %s", path)
+	if err := p.send(ctx, "GET", path, nil, &a); err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, s := range a.RRsets {
+		if s.Type != "TXT" || s.Name != providers.FQDN(name) {
+			continue
+		}
+		for _, r := range s.Records {
+			if !r.Disabled {
+				ret = append(ret, strings.Trim(r.Content, `"`))
+			}
+		}
+	}
+	return ret, nil
+}
+
+// patch applies the change on the rrset s of zone, then notifies the
+// secondaries and rectifies the zone if configured
+func (p PowerDNSProvider) patch(ctx context.Context, l zerolog.Logger, zone string, s rrset) error {
+	path := "/zones/" + url.PathEscape(zone)
+	body := map[string][]rrset{"rrsets": {s}}
+	l.Debug().Msgf("sending PATCH on %s", path)
+	if err := p.send(ctx, "PATCH", path, body, nil); err != nil {
+		return err
+	}
+
+	if p.Rectify {
+		l.Debug().Msgf("rectifying zone %s", zone)
+		if err := p.send(ctx, "PUT", path+"/rectify", nil, nil); err != nil {
+			return fmt.Errorf("cannot rectify zone %s: %w", zone, err)
+		}
+	}
+	if p.Notify {
+		l.Debug().Msgf("notifying the secondaries of zone %s", zone)
+		if err := p.send(ctx, "PUT", path+"/notify", nil, nil); err != nil {
+			return fmt.Errorf("cannot notify the secondaries of zone %s: %w", zone, err)
+		}
+	}
+	return nil
+}
+
+// zoneID returns the identifier of the zone holding name, that is the
+// longest zone of the server name belongs to
+func (p PowerDNSProvider) zoneID(ctx context.Context, l zerolog.Logger, name string) (string, error) {
+	if p.Zone != "" {
+		return providers.FQDN(p.Zone), nil
+	}
+
+	var zones []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	l.Debug().Msg("sending GET on /zones")
+	if err := p.send(ctx, "GET", "/zones", nil, &zones); err != nil {
+		return "", err
+	}
+
+	name = providers.FQDN(name)
+	var id, zone string
+	for _, z := range zones {
+		if (name == z.Name || strings.HasSuffix(name, "."+z.Name)) && len(z.Name) > len(zone) {
+			id, zone = z.ID, z.Name
+		}
+	}
+	if id == "" {
+		return "", fmt.Errorf("no PowerDNS zone holds %s", name)
+	}
+	return id, nil
+}
+
+// send sends a request authenticated with the API key on path, relative to
+// the server, with body encoded in JSON if not nil, and decodes the JSON
+// response in v if not nil.
+func (p PowerDNSProvider) send(ctx context.Context, method, path string, body, v interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	server := p.ServerID
+	if server == "" {
+		server = DefaultServerID
+	}
+	rawurl := strings.TrimSuffix(p.Endpoint, "/") + "/api/v1/servers/" + url.PathEscape(server) + path
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-API-Key", p.APIKey)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return fmt.Errorf("powerdns returned HTTP %d on %s %s: %s", r.StatusCode, method, path, e.Error)
+		}
+		return fmt.Errorf("powerdns returned HTTP %d on %s %s: %s", r.StatusCode, method, path, data)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,148 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+// fakePowerDNS is a minimal PowerDNS API stand-in with two zones
+type fakePowerDNS struct {
+	mu      sync.Mutex
+	rrsets  map[string]rrset
+	rectify int
+	notify  int
+}
+
+func (f *fakePowerDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-API-Key") != "key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"Unauthorized"}`)
+		return
+	}
+
+	const prefix = "/api/v1/servers/localhost/zones"
+	zone := strings.TrimPrefix(r.URL.Path, prefix+"/")
+	switch {
+	case r.Method == "GET" && r.URL.Path == prefix:
+		fmt.Fprint(w, `[{"id":"bar.com.","name":"bar.com."},{"id":"www.bar.com.","name":"www.bar.com."}]`)
+	case r.Method == "GET":
+		// the rrset filters are ignored, as by the older versions
+		var sets []rrset
+		for key, s := range f.rrsets {
+			if strings.HasPrefix(key, zone+"/") {
+				sets = append(sets, s)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]rrset{"rrsets": sets})
+	case r.Method == "PATCH":
+		var body struct {
+			RRsets []rrset `json:"rrsets"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, s := range body.RRsets {
+			key := zone + "/" + s.Name + " " + s.Type
+			switch s.ChangeType {
+			case "REPLACE":
+				s.ChangeType = ""
+				f.rrsets[key] = s
+			case "DELETE":
+				delete(f.rrsets, key)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && strings.HasSuffix(zone, "/rectify"):
+		f.rectify++
+		fmt.Fprint(w, `{"result":"Rectified"}`)
+	case r.Method == "PUT" && strings.HasSuffix(zone, "/notify"):
+		f.notify++
+		fmt.Fprint(w, `{"result":"Notification queued"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPowerDNSProvider(t *testing.T) {
+	fake := &fakePowerDNS{rrsets: make(map[string]rrset)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := PowerDNSProvider{
+		Endpoint: srv.URL,
+		APIKey:   "key",
+		Notify:   true,
+		Rectify:  true,
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	first := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	second := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "def"}
+	apex := providers.Record{Name: "_acme-challenge.bar.com", Value: "ghi"}
+	if err := p.CreateTXTRecords(ctx, l, first, apex); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if err := p.CreateTXTRecords(ctx, l, second); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	// the record of www.bar.com belongs to the longest matching zone
+	var got []string
+	for _, r := range fake.rrsets["www.bar.com./_acme-challenge.www.bar.com. TXT"].Records {
+		got = append(got, r.Content)
+	}
+	sort.Strings(got)
+	if want := `["abc" "def"]`; fmt.Sprint(got) != want {
+		t.Errorf("got records '%v', want '%v'", got, want)
+	}
+	if fake.rectify != 3 || fake.notify != 3 {
+		t.Errorf("got %d rectifications and %d notifications, want 3", fake.rectify, fake.notify)
+	}
+
+	ok, err := p.CheckIfRecordsAlreadyExist(ctx, l, first, second, apex)
+	if err != nil || !ok {
+		t.Errorf("got '%v' and error '%v', want true", ok, err)
+	}
+	ok, err = p.CheckIfRecordsAlreadyExist(ctx, l, providers.Record{Name: "_acme-challenge.blog.bar.com", Value: "abc"})
+	if err != nil || ok {
+		t.Errorf("got '%v' and error '%v', want false", ok, err)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(fake.rrsets) != 1 {
+		t.Errorf("got rrsets '%v' after cleaning", fake.rrsets)
+	}
+
+	if err := p.CreateDelegationRecord(ctx, l, "_acme-challenge.www.bar.com", "www.bar.com.uuid.dcv.cloudflare.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if got := fake.rrsets["www.bar.com./_acme-challenge.www.bar.com. CNAME"].Records; fmt.Sprint(got) != "[{www.bar.com.uuid.dcv.cloudflare.com. false}]" {
+		t.Errorf("got CNAME records '%v'", got)
+	}
+
+	if _, err := p.zoneID(ctx, l, "_acme-challenge.baz.org"); err == nil || !strings.Contains(err.Error(), "no PowerDNS zone") {
+		t.Errorf("got error '%v' for a missing zone", err)
+	}
+
+	p.APIKey = "wrong"
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.bar.com"); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("got error '%v' with a wrong API key", err)
+	}
+}
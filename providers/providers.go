@@ -1,6 +1,9 @@
 package providers
 
 import (
+	"context"
+	"strings"
+
 	"github.com/govirtuo/cfcr/config"
 	"github.com/rs/zerolog"
 )
@@ -8,30 +11,100 @@ import (
 const (
 	NONE = iota
 	OVH
+	ROUTE53
+	GCLOUD
+	AZURE
+	RFC2136
+	POWERDNS
 )
 
 var List = []string{
-	NONE: "none",
-	OVH:  "ovh",
+	NONE:     "none",
+	OVH:      "ovh",
+	ROUTE53:  "route53",
+	GCLOUD:   "gcloud",
+	AZURE:    "azure",
+	RFC2136:  "rfc2136",
+	POWERDNS: "powerdns",
+}
+
+// Record is a TXT record expected by Cloudflare. Name is fully-qualified, as
+// returned by Cloudflare API.
+type Record struct {
+	Name  string
+	Value string
+}
+
+func (r Record) String() string {
+	return r.Name + " " + r.Value
 }
 
 // Provider is an interface that represents a provider that can see its TXT records
-// being updated to allow Cloudflare to renew certs
+// being updated to allow Cloudflare to renew certs. Every method must give up
+// as soon as ctx is done.
 type Provider interface {
-	// CreateTXTRecords creates the correct number of TXT records, based on the
-	// content of txtvalues.
-	CreateTXTRecords(l zerolog.Logger, domain string, txtvalues ...string) error
-	// CleanTXTRecords removes all the TXT records set on the _acme-challenge.domain
-	// domain.
-	CleanTXTRecords(l zerolog.Logger, domain string) error
-	// CheckIfRecordsAlreadyExist returns true if the domain already has TXT
-	// records configured.
-	CheckIfRecordsAlreadyExist(l zerolog.Logger, domain string) (bool, error)
+	// CreateTXTRecords creates one TXT record per entry of records. Several
+	// records can share the same name.
+	CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...Record) error
+	// CleanTXTRecords removes all the TXT records set on the fully-qualified
+	// name.
+	CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error
+	// CheckIfRecordsAlreadyExist returns true if all the records are already
+	// set with their value.
+	CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...Record) (bool, error)
+}
+
+// DelegationProvider is implemented by the providers able to delegate the
+// validation of a domain to Cloudflare, using a CNAME record.
+type DelegationProvider interface {
+	Provider
+	// CreateDelegationRecord creates the CNAME record on the fully-qualified
+	// name pointing at target, replacing any existing CNAME record.
+	CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error
+}
+
+// GroupByName returns the values of records indexed by record name
+func GroupByName(records []Record) map[string][]string {
+	ret := make(map[string][]string)
+	for _, r := range records {
+		ret[r.Name] = append(ret[r.Name], r.Value)
+	}
+	return ret
+}
+
+// Contains returns true if v is one of values
+func Contains(values []string, v string) bool {
+	for _, vv := range values {
+		if vv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// FQDN returns name with a trailing dot, as expected by most DNS APIs
+func FQDN(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
 }
 
 func ProviderToUse(c config.Config) string {
 	if c.Auth.OVH.AppKey != "" && c.Auth.OVH.AppSecret != "" && c.Auth.OVH.ConsumerKey != "" {
 		return List[OVH]
 	}
+	if c.Auth.Route53.AccessKeyID != "" && c.Auth.Route53.SecretAccessKey != "" {
+		return List[ROUTE53]
+	}
+	if c.Auth.GCloud.ServiceAccountFile != "" {
+		return List[GCLOUD]
+	}
+	if c.Auth.Azure.TenantID != "" && c.Auth.Azure.ClientID != "" && c.Auth.Azure.ClientSecret != "" {
+		return List[AZURE]
+	}
+	if c.Auth.RFC2136.Server != "" && c.Auth.RFC2136.Zone != "" {
+		return List[RFC2136]
+	}
+	if c.Auth.PowerDNS.Endpoint != "" && c.Auth.PowerDNS.APIKey != "" {
+		return List[POWERDNS]
+	}
 	return List[NONE]
 }
@@ -0,0 +1,37 @@
+package providers
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		values []string
+		v      string
+		want   bool
+	}{
+		{values: []string{"abc", "def"}, v: "def", want: true},
+		{values: []string{"abc", "def"}, v: "ghi", want: false},
+		{values: nil, v: "abc", want: false},
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.values, tt.v); got != tt.want {
+			t.Errorf("Contains(%v, %s): got '%v', want '%v'", tt.values, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestFQDN(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "_acme-challenge.bar.com", want: "_acme-challenge.bar.com."},
+		{name: "_acme-challenge.bar.com.", want: "_acme-challenge.bar.com."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FQDN(tt.name); got != tt.want {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
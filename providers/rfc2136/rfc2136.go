@@ -0,0 +1,198 @@
+package rfc2136
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultTTL is the TTL of the TXT records created by the provider
+	DefaultTTL = 60
+	// DefaultAlgorithm is the TSIG algorithm used if none is set
+	DefaultAlgorithm = "hmac-sha256"
+
+	// fudge is the time difference allowed between cfcr and the server, in
+	// seconds, as recommended by RFC 8945
+	fudge = 300
+)
+
+var algorithms = map[string]string{
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// RFC2136Provider is a struct that implements the DelegationProvider interface
+// using DNS UPDATE messages (RFC 2136) signed with TSIG (RFC 8945), as
+// supported by most authoritative servers such as BIND or Knot.
+type RFC2136Provider struct {
+	// Server is the address of the primary server of Zone, port included
+	Server string
+	Zone   string
+	// Net is the transport of the messages, "udp" (the default) or "tcp"
+	Net string
+	TTL int
+
+	KeyName string
+	// KeyAlgorithm is either "hmac-sha256" (the default) or "hmac-sha512"
+	KeyAlgorithm string
+	// KeySecret is encoded in base64
+	KeySecret string
+}
+
+// CreateTXTRecords adds the records in a single update. Existing TXT
+// records are left untouched.
+func (p RFC2136Provider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	var rrs []dns.RR
+	for _, r := range records {
+		name, err := p.fqdn(r.Name)
+		if err != nil {
+			return err
+		}
+		rrs = append(rrs, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(ttl)},
+			Txt: split(r.Value),
+		})
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(p.Zone))
+	m.Insert(rrs)
+
+	l.Info().Msgf("adding %d TXT records in zone %s on %s", len(rrs), p.Zone, p.Server)
+	_, err := p.exchange(ctx, m)
+	return err
+}
+
+// CleanTXTRecords removes all the TXT records of name.
+func (p RFC2136Provider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	name, err := p.fqdn(name)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(p.Zone))
+	m.RemoveRRset([]dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT}}})
+
+	l.Info().Msgf("removing TXT records of %s on %s", name, p.Server)
+	_, err = p.exchange(ctx, m)
+	return err
+}
+
+// CheckIfRecordsAlreadyExist queries the server for the TXT records of each
+// record name and returns true if every record is set with its value.
+func (p RFC2136Provider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	for name, values := range providers.GroupByName(records) {
+		fqdn, err := p.fqdn(name)
+		if err != nil {
+			return false, err
+		}
+
+		m := new(dns.Msg)
+		m.SetQuestion(fqdn, dns.TypeTXT)
+		l.Debug().Msgf("querying TXT records of %s on %s", fqdn, p.Server)
+		r, err := p.exchange(ctx, m)
+		if err != nil {
+			return false, err
+		}
+
+		var existing []string
+		for _, rr := range r.Answer {
+			if txt, ok := rr.(*dns.TXT); ok {
+				existing = append(existing, strings.Join(txt.Txt, ""))
+			}
+		}
+		for _, v := range values {
+			if !providers.Contains(existing, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// CreateDelegationRecord replaces the CNAME record of name by one pointing at
+// target, in a single update.
+func (p RFC2136Provider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	name, err := p.fqdn(name)
+	if err != nil {
+		return err
+	}
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(p.Zone))
+	m.RemoveRRset([]dns.RR{&dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME}}})
+	m.Insert([]dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(ttl)},
+		Target: dns.Fqdn(target),
+	}})
+
+	l.Info().Msgf("setting CNAME record of %s on %s", name, p.Server)
+	_, err = p.exchange(ctx, m)
+	return err
+}
+
+// exchange signs m and sends it to the server. A response code other than
+// NOERROR or NXDOMAIN is returned as an error.
+func (p RFC2136Provider) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Net: p.Net}
+	if p.KeyName != "" {
+		alg := p.KeyAlgorithm
+		if alg == "" {
+			alg = DefaultAlgorithm
+		}
+		fqalg, ok := algorithms[strings.ToLower(alg)]
+		if !ok {
+			return nil, fmt.Errorf("TSIG algorithm %s is not supported", alg)
+		}
+
+		key := dns.Fqdn(p.KeyName)
+		c.TsigSecret = map[string]string{key: p.KeySecret}
+		m.SetTsig(key, fqalg, fudge, time.Now().Unix())
+	}
+
+	r, _, err := c.ExchangeContext(ctx, m, p.Server)
+	if err != nil {
+		return nil, fmt.Errorf("cannot exchange with %s: %w", p.Server, err)
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%s returned %s", p.Server, dns.RcodeToString[r.Rcode])
+	}
+	return r, nil
+}
+
+// fqdn returns the fully-qualified form of name, which must be part of the
+// zone
+func (p RFC2136Provider) fqdn(name string) (string, error) {
+	name = dns.Fqdn(name)
+	if !dns.IsSubDomain(dns.Fqdn(p.Zone), name) {
+		return "", fmt.Errorf("%s is not part of the zone %s", name, p.Zone)
+	}
+	return name, nil
+}
+
+// split cuts value in strings of at most 255 bytes, the maximum length of a
+// TXT record string
+func split(value string) []string {
+	var ret []string
+	for len(value) > 255 {
+		ret = append(ret, value[:255])
+		value = value[255:]
+	}
+	return append(ret, value)
+}
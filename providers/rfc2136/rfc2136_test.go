@@ -0,0 +1,162 @@
+package rfc2136
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+const (
+	keyName   = "cfcr."
+	keySecret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// fakeServer is a minimal authoritative server for bar.com, only accepting
+// the updates signed with the test key
+type fakeServer struct {
+	mu      sync.Mutex
+	records map[string][]string
+	cnames  map[string]string
+}
+
+func (f *fakeServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	defer func() {
+		if r.IsTsig() != nil {
+			m.SetTsig(keyName, dns.HmacSHA256, fudge, int64(r.IsTsig().TimeSigned))
+		}
+		w.WriteMsg(m)
+	}()
+
+	switch r.Opcode {
+	case dns.OpcodeUpdate:
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			m.Rcode = dns.RcodeRefused
+			return
+		}
+		for _, rr := range r.Ns {
+			name := rr.Header().Name
+			switch {
+			case rr.Header().Rrtype == dns.TypeCNAME && rr.Header().Class == dns.ClassINET:
+				f.cnames[name] = rr.(*dns.CNAME).Target
+			case rr.Header().Rrtype == dns.TypeCNAME && rr.Header().Class == dns.ClassANY:
+				delete(f.cnames, name)
+			case rr.Header().Class == dns.ClassINET:
+				f.records[name] = append(f.records[name], strings.Join(rr.(*dns.TXT).Txt, ""))
+			case rr.Header().Class == dns.ClassANY:
+				delete(f.records, name)
+			}
+		}
+	case dns.OpcodeQuery:
+		q := r.Question[0]
+		values, ok := f.records[q.Name]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+			return
+		}
+		for _, v := range values {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: DefaultTTL},
+				Txt: split(v),
+			})
+		}
+	}
+}
+
+func startServer(t *testing.T, f *fakeServer) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		Handler:           f,
+		TsigSecret:        map[string]string{keyName: keySecret},
+		NotifyStartedFunc: func() { close(started) },
+		// the default function rejects updates
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestRFC2136Provider(t *testing.T) {
+	fake := &fakeServer{records: make(map[string][]string), cnames: make(map[string]string)}
+	p := RFC2136Provider{
+		Server:    startServer(t, fake),
+		Zone:      "bar.com",
+		KeyName:   "cfcr",
+		KeySecret: keySecret,
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	first := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	second := providers.Record{Name: "_acme-challenge.www.bar.com", Value: strings.Repeat("d", 300)}
+	if err := p.CreateTXTRecords(ctx, l, first, second); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	got := fake.records["_acme-challenge.www.bar.com."]
+	sort.Strings(got)
+	if want := fmt.Sprint([]string{"abc", second.Value}); fmt.Sprint(got) != want {
+		t.Errorf("got records '%v', want '%v'", got, want)
+	}
+
+	ok, err := p.CheckIfRecordsAlreadyExist(ctx, l, first, second)
+	if err != nil || !ok {
+		t.Errorf("got '%v' and error '%v', want true", ok, err)
+	}
+	ok, err = p.CheckIfRecordsAlreadyExist(ctx, l, providers.Record{Name: "_acme-challenge.bar.com", Value: "abc"})
+	if err != nil || ok {
+		t.Errorf("got '%v' and error '%v', want false", ok, err)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(fake.records) != 0 {
+		t.Errorf("got records '%v' after cleaning", fake.records)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.baz.org"); err == nil {
+		t.Errorf("got no error for a name outside of the zone")
+	}
+
+	// the CNAME record is replaced if it already exists
+	for _, target := range []string{"www.bar.com.old.dcv.cloudflare.com", "www.bar.com.uuid.dcv.cloudflare.com"} {
+		if err := p.CreateDelegationRecord(ctx, l, "_acme-challenge.www.bar.com", target); err != nil {
+			t.Fatalf("got error '%v'", err)
+		}
+	}
+	if got := fake.cnames["_acme-challenge.www.bar.com."]; got != "www.bar.com.uuid.dcv.cloudflare.com." {
+		t.Errorf("got CNAME target '%v'", got)
+	}
+
+	unsigned := p
+	unsigned.KeyName = ""
+	if err := unsigned.CreateTXTRecords(ctx, l, first); err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Errorf("got error '%v' for an unsigned update", err)
+	}
+
+	unsupported := p
+	unsupported.KeyAlgorithm = "hmac-md5"
+	if err := unsupported.CreateTXTRecords(ctx, l, first); err == nil {
+		t.Errorf("got no error for an unsupported algorithm")
+	}
+}
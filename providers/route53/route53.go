@@ -0,0 +1,368 @@
+package route53
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/awsauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultEndpoint is the endpoint of AWS Route 53 API
+	DefaultEndpoint = "https://route53.amazonaws.com"
+	// DefaultTTL is the TTL of the TXT record sets created by the provider
+	DefaultTTL = 60
+	// DefaultPollInterval is the interval between two checks of the status
+	// of a change
+	DefaultPollInterval = 5 * time.Second
+
+	apiVersion = "2013-04-01"
+	namespace  = "https://route53.amazonaws.com/doc/2013-04-01/"
+	// Route 53 is a global service whose requests are signed for us-east-1
+	signingRegion = "us-east-1"
+)
+
+// Route53Provider is a struct that implements the DelegationProvider
+// interface. All the values of a record name are kept in a single TXT record
+// set, and every change is waited for until it is propagated to all the Route
+// 53 DNS servers, on a best-effort basis.
+type Route53Provider struct {
+	Credentials awsauth.Credentials
+	Endpoint    string
+	// HostedZoneID is the ID of the hosted zone holding the records. If not
+	// set, the hosted zone is looked up from the record names.
+	HostedZoneID string
+	TTL          int
+	PollInterval time.Duration
+
+	Client *http.Client
+}
+
+type resourceRecordSet struct {
+	Name            string           `xml:"Name"`
+	Type            string           `xml:"Type"`
+	TTL             int              `xml:"TTL"`
+	ResourceRecords []resourceRecord `xml:"ResourceRecords>ResourceRecord"`
+}
+
+type resourceRecord struct {
+	Value string `xml:"Value"`
+}
+
+type change struct {
+	Action            string            `xml:"Action"`
+	ResourceRecordSet resourceRecordSet `xml:"ResourceRecordSet"`
+}
+
+type changeInfo struct {
+	ID     string `xml:"Id"`
+	Status string `xml:"Status"`
+}
+
+// values returns the unquoted TXT values of the set, if any
+func (s *resourceRecordSet) values() []string {
+	if s == nil {
+		return nil
+	}
+	var ret []string
+	for _, r := range s.ResourceRecords {
+		ret = append(ret, strings.Trim(r.Value, `"`))
+	}
+	return ret
+}
+
+// CreateTXTRecords upserts the TXT record sets of records, merging the new
+// values with the existing ones. The record sets of a hosted zone are changed
+// in a single batch, so that the propagation is only waited for once.
+func (p Route53Provider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...providers.Record) error {
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	batches := make(map[string][]change)
+	for name, values := range providers.GroupByName(records) {
+		zoneID, err := p.hostedZoneID(ctx, l, name)
+		if err != nil {
+			return err
+		}
+
+		set, err := p.getRecordSet(ctx, l, zoneID, name)
+		if err != nil {
+			return err
+		}
+		merged := set.values()
+		for _, v := range values {
+			if !providers.Contains(merged, v) {
+				merged = append(merged, v)
+			}
+		}
+
+		upsert := resourceRecordSet{Name: providers.FQDN(name), Type: "TXT", TTL: ttl}
+		for _, v := range merged {
+			upsert.ResourceRecords = append(upsert.ResourceRecords, resourceRecord{Value: `"` + v + `"`})
+		}
+		l.Info().Msgf("upserting %d values in %s TXT record set on Route 53 API", len(merged), name)
+		batches[zoneID] = append(batches[zoneID], change{Action: "UPSERT", ResourceRecordSet: upsert})
+	}
+
+	// the batches are all sent before waiting, so that they propagate
+	// together
+	var infos []changeInfo
+	for zoneID, changes := range batches {
+		info, err := p.change(ctx, zoneID, changes...)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+	for _, info := range infos {
+		p.waitForChange(ctx, l, info)
+	}
+	return nil
+}
+
+// CleanTXTRecords deletes the TXT record set of name.
+func (p Route53Provider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	zoneID, err := p.hostedZoneID(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	set, err := p.getRecordSet(ctx, l, zoneID, name)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		l.Info().Msg("nothing to clean")
+		return nil
+	}
+
+	// Route 53 only deletes a record set given with its current values
+	l.Info().Msgf("deleting %s TXT record set on Route 53 API", name)
+	info, err := p.change(ctx, zoneID, change{Action: "DELETE", ResourceRecordSet: *set})
+	if err != nil {
+		return err
+	}
+	p.waitForChange(ctx, l, info)
+	return nil
+}
+
+// CheckIfRecordsAlreadyExist returns true if every record is set with its
+// value.
+func (p Route53Provider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...providers.Record) (bool, error) {
+	for name, values := range providers.GroupByName(records) {
+		zoneID, err := p.hostedZoneID(ctx, l, name)
+		if err != nil {
+			return false, err
+		}
+
+		set, err := p.getRecordSet(ctx, l, zoneID, name)
+		if err != nil {
+			return false, err
+		}
+		existing := set.values()
+		for _, v := range values {
+			if !providers.Contains(existing, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// CreateDelegationRecord upserts the CNAME record set of name, pointing at
+// target.
+func (p Route53Provider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	zoneID, err := p.hostedZoneID(ctx, l, name)
+	if err != nil {
+		return err
+	}
+
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	upsert := resourceRecordSet{
+		Name:            providers.FQDN(name),
+		Type:            "CNAME",
+		TTL:             ttl,
+		ResourceRecords: []resourceRecord{{Value: providers.FQDN(target)}},
+	}
+
+	l.Info().Msgf("upserting %s CNAME record set on Route 53 API", name)
+	info, err := p.change(ctx, zoneID, change{Action: "UPSERT", ResourceRecordSet: upsert})
+	if err != nil {
+		return err
+	}
+	p.waitForChange(ctx, l, info)
+	return nil
+}
+
+// hostedZoneID returns the ID of the hosted zone holding name, walking up its
+// labels until a hosted zone is found
+func (p Route53Provider) hostedZoneID(ctx context.Context, l zerolog.Logger, name string) (string, error) {
+	if p.HostedZoneID != "" {
+		return p.HostedZoneID, nil
+	}
+
+	type APISchema struct {
+		HostedZones []struct {
+			ID   string `xml:"Id"`
+			Name string `xml:"Name"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		candidate := strings.Join(labels[i:], ".")
+		q := url.Values{"dnsname": {candidate}, "maxitems": {"1"}}
+
+		var a APISchema
+		l.Debug().Msgf("looking up hosted zone %s on Route 53 API", candidate)
+		if err := p.send(ctx, "GET", "/hostedzonesbyname?"+q.Encode(), nil, &a); err != nil {
+			return "", err
+		}
+		// the zones are listed from dnsname, the first one is not
+		// necessarily the requested one
+		if len(a.HostedZones) > 0 && a.HostedZones[0].Name == providers.FQDN(candidate) {
+			return strings.TrimPrefix(a.HostedZones[0].ID, "/hostedzone/"), nil
+		}
+	}
+	return "", fmt.Errorf("no Route 53 hosted zone found for %s", name)
+}
+
+// getRecordSet returns the TXT record set of name, or nil if there is none
+func (p Route53Provider) getRecordSet(ctx context.Context, l zerolog.Logger, zoneID, name string) (*resourceRecordSet, error) {
+	type APISchema struct {
+		ResourceRecordSets []resourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+
+	q := url.Values{"name": {providers.FQDN(name)}, "type": {"TXT"}, "maxitems": {"1"}}
+	var a APISchema
+	l.Debug().Msgf("getting %s TXT record set on Route 53 API", name)
+	if err := p.send(ctx, "GET", "/hostedzone/"+zoneID+"/rrset?"+q.Encode(), nil, &a); err != nil {
+		return nil, err
+	}
+
+	// the record sets are listed from name, the first one is not
+	// necessarily the requested one
+	if len(a.ResourceRecordSets) == 0 {
+		return nil, nil
+	}
+	set := a.ResourceRecordSets[0]
+	if !strings.EqualFold(set.Name, providers.FQDN(name)) || set.Type != "TXT" {
+		return nil, nil
+	}
+	return &set, nil
+}
+
+// change sends changes in a single batch and returns the information of the
+// change, to be waited for
+func (p Route53Provider) change(ctx context.Context, zoneID string, changes ...change) (changeInfo, error) {
+	type ChangeResourceRecordSetsRequest struct {
+		XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}
+	type APISchema struct {
+		ChangeInfo changeInfo `xml:"ChangeInfo"`
+	}
+
+	req := ChangeResourceRecordSetsRequest{Xmlns: namespace, Changes: changes}
+	var a APISchema
+	if err := p.send(ctx, "POST", "/hostedzone/"+zoneID+"/rrset/", req, &a); err != nil {
+		return changeInfo{}, err
+	}
+	return a.ChangeInfo, nil
+}
+
+// waitForChange polls the status of the change until it is INSYNC. Route 53
+// applies an accepted change whatever happens, so the wait is best-effort: it
+// is only logged if ctx is done or if the status cannot be polled, usually
+// because the propagation takes longer than the call timeout.
+func (p Route53Provider) waitForChange(ctx context.Context, l zerolog.Logger, info changeInfo) {
+	type APISchema struct {
+		ChangeInfo changeInfo `xml:"ChangeInfo"`
+	}
+
+	interval := p.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	id := strings.TrimPrefix(info.ID, "/change/")
+	for info.Status != "INSYNC" {
+		l.Debug().Msgf("change %s is %s, waiting", id, info.Status)
+		select {
+		case <-ctx.Done():
+			l.Warn().Err(ctx.Err()).Msgf("change %s is still %s, it will keep propagating in the background", id, info.Status)
+			return
+		case <-time.After(interval):
+		}
+
+		var a APISchema
+		if err := p.send(ctx, "GET", "/change/"+id, nil, &a); err != nil {
+			l.Warn().Err(err).Msgf("cannot get the status of change %s, it will keep propagating in the background", id)
+			return
+		}
+		info.Status = a.ChangeInfo.Status
+	}
+	l.Debug().Msgf("change %s is in sync", id)
+}
+
+// send sends a signed request on path, with body encoded in XML if not nil,
+// and decodes the XML response in v
+func (p Route53Provider) send(ctx context.Context, method, path string, body, v interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = xml.Marshal(body); err != nil {
+			return err
+		}
+		payload = append([]byte(xml.Header), payload...)
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	rawurl := strings.TrimSuffix(endpoint, "/") + "/" + apiVersion + path
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	awsauth.Sign(req, payload, p.Credentials, signingRegion, "route53", time.Now())
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode >= 300 {
+		return fmt.Errorf("route 53 returned HTTP %d on %s %s: %s", r.StatusCode, method, path, data)
+	}
+	return xml.Unmarshal(data, v)
+}
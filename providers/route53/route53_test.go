@@ -0,0 +1,214 @@
+package route53
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/govirtuo/cfcr/awsauth"
+	"github.com/govirtuo/cfcr/providers"
+	"github.com/rs/zerolog"
+)
+
+// fakeRoute53 is a minimal Route 53 stand-in with a single hosted zone,
+// keeping the TXT and CNAME record sets in memory
+type fakeRoute53 struct {
+	mu      sync.Mutex
+	sets    map[string][]string
+	cnames  map[string]string
+	batches int
+	changes map[string]int
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzonesbyname":
+		// like Route 53, the zones following dnsname are returned
+		name := "bar.com."
+		if q.Get("dnsname") != "bar.com" {
+			name = "foo.com."
+		}
+		fmt.Fprintf(w, `<ListHostedZonesByNameResponse><HostedZones><HostedZone><Id>/hostedzone/Z1</Id><Name>%s</Name></HostedZone></HostedZones></ListHostedZonesByNameResponse>`, name)
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+		fmt.Fprint(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>`)
+		if values, ok := f.sets[q.Get("name")]; ok {
+			fmt.Fprintf(w, `<ResourceRecordSet><Name>%s</Name><Type>TXT</Type><TTL>60</TTL><ResourceRecords>`, q.Get("name"))
+			for _, v := range values {
+				fmt.Fprintf(w, `<ResourceRecord><Value>%s</Value></ResourceRecord>`, v)
+			}
+			fmt.Fprint(w, `</ResourceRecords></ResourceRecordSet>`)
+		}
+		fmt.Fprint(w, `</ResourceRecordSets></ListResourceRecordSetsResponse>`)
+	case r.Method == "POST" && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset/":
+		var req struct {
+			Changes []struct {
+				Action            string            `xml:"Action"`
+				ResourceRecordSet resourceRecordSet `xml:"ResourceRecordSet"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.batches++
+		for _, c := range req.Changes {
+			set := c.ResourceRecordSet
+			if set.Type == "CNAME" && c.Action == "UPSERT" {
+				f.cnames[set.Name] = set.ResourceRecords[0].Value
+				continue
+			}
+			var values []string
+			for _, rr := range set.ResourceRecords {
+				values = append(values, rr.Value)
+			}
+			switch c.Action {
+			case "UPSERT":
+				f.sets[set.Name] = values
+			case "DELETE":
+				if fmt.Sprint(f.sets[set.Name]) != fmt.Sprint(values) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				delete(f.sets, set.Name)
+			}
+		}
+		f.changes["C1"] = 0
+		fmt.Fprint(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/change/C1":
+		// the change gets in sync on the second poll
+		f.changes["C1"]++
+		status := "PENDING"
+		if f.changes["C1"] > 1 {
+			status = "INSYNC"
+		}
+		fmt.Fprintf(w, `<GetChangeResponse><ChangeInfo><Id>/change/C1</Id><Status>%s</Status></ChangeInfo></GetChangeResponse>`, status)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRoute53Provider(t *testing.T) {
+	fake := &fakeRoute53{sets: make(map[string][]string), cnames: make(map[string]string), changes: make(map[string]int)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := Route53Provider{
+		Credentials:  awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		Endpoint:     srv.URL,
+		PollInterval: time.Millisecond,
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	first := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	second := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "def"}
+	if err := p.CreateTXTRecords(ctx, l, first); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if err := p.CreateTXTRecords(ctx, l, second); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	got := fake.sets["_acme-challenge.www.bar.com."]
+	sort.Strings(got)
+	if want := `["abc" "def"]`; fmt.Sprint(got) != want {
+		t.Errorf("got values '%v', want '%v'", got, want)
+	}
+	if fake.changes["C1"] != 2 {
+		t.Errorf("got %d change polls, want 2", fake.changes["C1"])
+	}
+
+	ok, err := p.CheckIfRecordsAlreadyExist(ctx, l, first, second)
+	if err != nil || !ok {
+		t.Errorf("got '%v' and error '%v', want true", ok, err)
+	}
+	ok, err = p.CheckIfRecordsAlreadyExist(ctx, l, providers.Record{Name: "_acme-challenge.bar.com", Value: "abc"})
+	if err != nil || ok {
+		t.Errorf("got '%v' and error '%v', want false", ok, err)
+	}
+
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(fake.sets) != 0 {
+		t.Errorf("got record sets '%v' after cleaning", fake.sets)
+	}
+	if err := p.CleanTXTRecords(ctx, l, "_acme-challenge.www.bar.com"); err != nil {
+		t.Errorf("got error '%v' cleaning nothing", err)
+	}
+
+	// the record sets of several names are changed in a single batch
+	fake.batches = 0
+	apex := providers.Record{Name: "_acme-challenge.bar.com", Value: "ghi"}
+	if err := p.CreateTXTRecords(ctx, l, first, apex); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if fake.batches != 1 || len(fake.sets) != 2 {
+		t.Errorf("got %d batches and record sets '%v', want 1 batch and 2 record sets", fake.batches, fake.sets)
+	}
+
+	if err := p.CreateDelegationRecord(ctx, l, "_acme-challenge.www.bar.com", "www.bar.com.uuid.dcv.cloudflare.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if got := fake.cnames["_acme-challenge.www.bar.com."]; got != "www.bar.com.uuid.dcv.cloudflare.com." {
+		t.Errorf("got CNAME target '%v'", got)
+	}
+}
+
+func TestRoute53Provider_slowPropagation(t *testing.T) {
+	fake := &fakeRoute53{sets: make(map[string][]string), cnames: make(map[string]string), changes: make(map[string]int)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := Route53Provider{
+		Credentials:  awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		Endpoint:     srv.URL,
+		PollInterval: time.Hour,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the change is accepted but still pending when the call times out
+	record := providers.Record{Name: "_acme-challenge.www.bar.com", Value: "abc"}
+	if err := p.CreateTXTRecords(ctx, zerolog.Nop(), record); err != nil {
+		t.Fatalf("got error '%v' for a change still propagating", err)
+	}
+	if _, ok := fake.sets["_acme-challenge.www.bar.com."]; !ok {
+		t.Errorf("got record sets '%v', want the upserted one", fake.sets)
+	}
+}
+
+func TestRoute53Provider_hostedZoneID(t *testing.T) {
+	srv := httptest.NewServer(&fakeRoute53{})
+	defer srv.Close()
+
+	p := Route53Provider{
+		Credentials: awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		Endpoint:    srv.URL,
+	}
+	id, err := p.hostedZoneID(context.Background(), zerolog.Nop(), "_acme-challenge.www.bar.com")
+	if err != nil || id != "Z1" {
+		t.Errorf("got '%v' and error '%v', want 'Z1'", id, err)
+	}
+	if _, err := p.hostedZoneID(context.Background(), zerolog.Nop(), "_acme-challenge.baz.org"); err == nil {
+		t.Errorf("got no error for a missing hosted zone")
+	}
+}
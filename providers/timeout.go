@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// WithTimeout returns a Provider bounding every call to p with timeout. The
+// returned Provider is a DelegationProvider if p is one. p is returned as is if
+// timeout is not positive.
+func WithTimeout(p Provider, timeout time.Duration) Provider {
+	if timeout <= 0 {
+		return p
+	}
+
+	tp := timeoutProvider{p: p, timeout: timeout}
+	if dp, ok := p.(DelegationProvider); ok {
+		return timeoutDelegationProvider{timeoutProvider: tp, dp: dp}
+	}
+	return tp
+}
+
+type timeoutProvider struct {
+	p       Provider
+	timeout time.Duration
+}
+
+func (t timeoutProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...Record) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.p.CreateTXTRecords(ctx, l, records...)
+}
+
+func (t timeoutProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.p.CleanTXTRecords(ctx, l, name)
+}
+
+func (t timeoutProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...Record) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.p.CheckIfRecordsAlreadyExist(ctx, l, records...)
+}
+
+type timeoutDelegationProvider struct {
+	timeoutProvider
+	dp DelegationProvider
+}
+
+func (t timeoutDelegationProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.dp.CreateDelegationRecord(ctx, l, name, target)
+}
@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// blockingProvider waits for its context to be done on every call
+type blockingProvider struct{}
+
+func (blockingProvider) CreateTXTRecords(ctx context.Context, l zerolog.Logger, records ...Record) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingProvider) CleanTXTRecords(ctx context.Context, l zerolog.Logger, name string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingProvider) CheckIfRecordsAlreadyExist(ctx context.Context, l zerolog.Logger, records ...Record) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+type blockingDelegationProvider struct {
+	blockingProvider
+}
+
+func (blockingDelegationProvider) CreateDelegationRecord(ctx context.Context, l zerolog.Logger, name, target string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithTimeout(t *testing.T) {
+	p := WithTimeout(blockingProvider{}, 10*time.Millisecond)
+	if err := p.CleanTXTRecords(context.Background(), zerolog.Nop(), "_acme-challenge.bar.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error '%v', want '%v'", err, context.DeadlineExceeded)
+	}
+	if _, ok := p.(DelegationProvider); ok {
+		t.Errorf("got a DelegationProvider from a Provider")
+	}
+
+	dp, ok := WithTimeout(blockingDelegationProvider{}, 10*time.Millisecond).(DelegationProvider)
+	if !ok {
+		t.Fatalf("got a Provider from a DelegationProvider")
+	}
+	if err := dp.CreateDelegationRecord(context.Background(), zerolog.Nop(), "_acme-challenge.bar.com", "target"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error '%v', want '%v'", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,106 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/govirtuo/cfcr/publishers"
+	"github.com/rs/zerolog"
+)
+
+// validationDirs are the directories Cloudflare fetches the HTTP validation
+// tokens from, depending on the certificate authority. Since Root may be the
+// document root of a live website, they are the only ones the publisher
+// writes in and cleans.
+var validationDirs = []string{"/.well-known/acme-challenge", "/.well-known/pki-validation"}
+
+// FilePublisher is a struct that implements the Publisher interface. The
+// tokens are written in a file tree, one directory per host, that is meant to
+// be served by a web server: the token of
+// http://foo.com/.well-known/pki-validation/abc.txt is written in
+// <Root>/foo.com/.well-known/pki-validation/abc.txt.
+type FilePublisher struct {
+	Root string
+}
+
+// Publish writes body in the file matching rawurl, which must be in one of
+// the validation directories.
+func (p FilePublisher) Publish(ctx context.Context, l zerolog.Logger, rawurl, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	host, urlpath, err := publishers.SplitURL(rawurl)
+	if err != nil {
+		return err
+	}
+	if !isValidationDir(path.Dir(urlpath)) {
+		return fmt.Errorf("validation URL %s is not in a validation directory", rawurl)
+	}
+
+	hd, err := p.hostDir(host)
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(hd, filepath.FromSlash(urlpath))
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+		return err
+	}
+	l.Debug().Msgf("writing HTTP validation token in %s", f)
+	return os.WriteFile(f, []byte(body), 0o644)
+}
+
+// Clean removes the files of the validation directories of host. The other
+// files of the host directory are left untouched.
+func (p FilePublisher) Clean(ctx context.Context, l zerolog.Logger, host string) error {
+	hd, err := p.hostDir(host)
+	if err != nil {
+		return err
+	}
+	for _, dir := range validationDirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d := filepath.Join(hd, filepath.FromSlash(dir))
+		entries, err := os.ReadDir(d)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			if !e.Type().IsRegular() {
+				continue
+			}
+			f := filepath.Join(d, e.Name())
+			l.Debug().Msgf("removing HTTP validation token %s", f)
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hostDir returns the directory of host under Root. An error is returned if
+// host is not a single path element, so that it cannot escape Root.
+func (p FilePublisher) hostDir(host string) (string, error) {
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return "", fmt.Errorf("host %s is not a valid directory name", host)
+	}
+	return filepath.Join(p.Root, host), nil
+}
+
+func isValidationDir(dir string) bool {
+	for _, d := range validationDirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFilePublisher(t *testing.T) {
+	root := t.TempDir()
+	p := FilePublisher{Root: root}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	if err := p.Publish(ctx, l, "http://www.bar.com/.well-known/pki-validation/abc.txt", "token"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "www.bar.com", ".well-known", "pki-validation", "abc.txt"))
+	if err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if string(data) != "token" {
+		t.Errorf("got '%v', want 'token'", string(data))
+	}
+
+	if err := p.Publish(ctx, l, "http://www.bar.com/../../etc/passwd", "token"); err == nil {
+		t.Errorf("publishing outside of the root should fail")
+	}
+	if err := p.Publish(ctx, l, "http://www.bar.com/index.html", "token"); err == nil {
+		t.Errorf("publishing outside of the validation directories should fail")
+	}
+
+	// the other files of the host directory, such as a website, must survive
+	// the cleaning
+	index := filepath.Join(root, "www.bar.com", "index.html")
+	if err := os.WriteFile(index, []byte("<html>"), 0o644); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	if err := p.Clean(ctx, l, "www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "www.bar.com", ".well-known", "pki-validation", "abc.txt")); !os.IsNotExist(err) {
+		t.Errorf("token should be removed, got '%v'", err)
+	}
+	if _, err := os.Stat(index); err != nil {
+		t.Errorf("website file should be kept, got '%v'", err)
+	}
+
+	if err := p.Clean(ctx, l, "blog.bar.com"); err != nil {
+		t.Errorf("cleaning a host without token got error '%v'", err)
+	}
+}
+
+func TestFilePublisher_invalidHost(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	p := FilePublisher{Root: root}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	for _, host := range []string{"", ".", "..", "../bar.com", `..\bar.com`} {
+		if err := p.Clean(ctx, l, host); err == nil {
+			t.Errorf("cleaning host '%s' should fail", host)
+		}
+	}
+	if err := p.Publish(ctx, l, "http://../.well-known/pki-validation/abc.txt", "token"); err == nil {
+		t.Errorf("publishing for host '..' should fail")
+	}
+	if _, err := os.Stat(filepath.Join(root, "..", ".well-known")); !os.IsNotExist(err) {
+		t.Errorf("no file should be written outside of the root, got '%v'", err)
+	}
+}
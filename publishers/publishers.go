@@ -0,0 +1,65 @@
+package publishers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/govirtuo/cfcr/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	NONE = iota
+	FILE
+	S3
+	SERVER
+)
+
+var List = []string{
+	NONE:   "none",
+	FILE:   "file",
+	S3:     "s3",
+	SERVER: "server",
+}
+
+// Publisher is an interface that represents a place where the HTTP validation
+// tokens of Cloudflare certificate packs can be published, for Cloudflare to
+// fetch them. Every method must give up as soon as ctx is done.
+type Publisher interface {
+	// Publish makes body available at rawurl.
+	Publish(ctx context.Context, l zerolog.Logger, rawurl, body string) error
+	// Clean removes all the tokens published for host.
+	Clean(ctx context.Context, l zerolog.Logger, host string) error
+}
+
+func PublisherToUse(c config.Config) string {
+	switch {
+	case c.HTTPChallenge.File.Root != "":
+		return List[FILE]
+	case c.HTTPChallenge.S3.Bucket != "":
+		return List[S3]
+	case c.HTTPChallenge.Server.Port != "":
+		return List[SERVER]
+	}
+	return List[NONE]
+}
+
+// SplitURL returns the host and the path of the validation URL rawurl. An
+// error is returned if the path tries to escape its root.
+func SplitURL(rawurl string) (string, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("validation URL %s has no host", rawurl)
+	}
+
+	if strings.Contains(u.Path, "..") {
+		return "", "", fmt.Errorf("validation URL %s has an invalid path", rawurl)
+	}
+	return strings.ToLower(u.Hostname()), path.Clean("/" + u.Path), nil
+}
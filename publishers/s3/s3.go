@@ -0,0 +1,141 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/govirtuo/cfcr/awsauth"
+	"github.com/govirtuo/cfcr/publishers"
+	"github.com/rs/zerolog"
+)
+
+// DefaultEndpoint is the endpoint of AWS S3
+const DefaultEndpoint = "https://s3.amazonaws.com"
+
+// S3Publisher is a struct that implements the Publisher interface. The tokens
+// are uploaded in a bucket of an S3-compatible storage, one prefix per host:
+// the token of http://foo.com/.well-known/abc is uploaded as
+// <Prefix>foo.com/.well-known/abc. Requests are sent path-style, so that any
+// S3-compatible storage can be used.
+type S3Publisher struct {
+	Credentials awsauth.Credentials
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Prefix      string
+
+	Client *http.Client
+}
+
+// Publish uploads body in the object matching rawurl.
+func (p S3Publisher) Publish(ctx context.Context, l zerolog.Logger, rawurl, body string) error {
+	host, path, err := publishers.SplitURL(rawurl)
+	if err != nil {
+		return err
+	}
+
+	key := p.Prefix + host + path
+	l.Debug().Msgf("uploading HTTP validation token in s3://%s/%s", p.Bucket, key)
+	_, err = p.send(ctx, "PUT", p.objectURL(key), []byte(body))
+	return err
+}
+
+// Clean removes all the objects of host.
+func (p S3Publisher) Clean(ctx context.Context, l zerolog.Logger, host string) error {
+	type listBucketResult struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	var keys []string
+	q := url.Values{
+		"list-type": {"2"},
+		"prefix":    {p.Prefix + strings.ToLower(host) + "/"},
+	}
+	for {
+		data, err := p.send(ctx, "GET", p.bucketURL()+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+
+		var res listBucketResult
+		if err := xml.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+
+	for _, k := range keys {
+		l.Debug().Msgf("removing HTTP validation token s3://%s/%s", p.Bucket, k)
+		if _, err := p.send(ctx, "DELETE", p.objectURL(k), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p S3Publisher) bucketURL() string {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/" + p.Bucket
+}
+
+func (p S3Publisher) objectURL(key string) string {
+	return p.bucketURL() + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// send sends a signed request and returns the body of the response
+func (p S3Publisher) send(ctx context.Context, method, rawurl string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	region := p.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	awsauth.Sign(req, payload, p.Credentials, region, "s3", time.Now())
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.StatusCode >= 300 {
+		return nil, fmt.Errorf("s3 returned HTTP %d on %s %s: %s", r.StatusCode, method, rawurl, data)
+	}
+	return data, nil
+}
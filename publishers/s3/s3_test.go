@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/govirtuo/cfcr/awsauth"
+	"github.com/rs/zerolog"
+)
+
+// fakeS3 is a minimal path-style S3 stand-in keeping the objects in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case "PUT":
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = string(body)
+	case "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET":
+		fmt.Fprint(w, "<ListBucketResult>")
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+			}
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	}
+}
+
+func TestS3Publisher(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string]string)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := S3Publisher{
+		Credentials: awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		Endpoint:    srv.URL,
+		Bucket:      "bucket",
+		Prefix:      "tokens/",
+	}
+	ctx := context.Background()
+	l := zerolog.Nop()
+
+	if err := p.Publish(ctx, l, "http://www.bar.com/.well-known/pki-validation/abc.txt", "token"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if err := p.Publish(ctx, l, "http://blog.bar.com/.well-known/pki-validation/def.txt", "token"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if got := fake.objects["tokens/www.bar.com/.well-known/pki-validation/abc.txt"]; got != "token" {
+		t.Errorf("got object '%v', want 'token'", got)
+	}
+
+	if err := p.Clean(ctx, l, "www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(fake.objects) != 1 {
+		t.Errorf("got %d objects after cleaning, want 1: %v", len(fake.objects), fake.objects)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govirtuo/cfcr/publishers"
+	"github.com/rs/zerolog"
+)
+
+// ServerPublisher is a struct that implements the Publisher interface. The
+// tokens are kept in memory and served by an embedded HTTP server, which
+// requests for the validation URLs must be routed to.
+type ServerPublisher struct {
+	Addr string
+
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+// Init initializes the publisher, without starting its server
+func Init(addr, port string) *ServerPublisher {
+	return &ServerPublisher{
+		Addr:   addr + ":" + port,
+		tokens: make(map[string]string),
+	}
+}
+
+// Start starts the HTTP server serving the tokens
+func (p *ServerPublisher) Start() error {
+	srv := &http.Server{
+		Addr:         p.Addr,
+		Handler:      p,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// Publish makes body available at rawurl.
+func (p *ServerPublisher) Publish(ctx context.Context, l zerolog.Logger, rawurl, body string) error {
+	host, path, err := publishers.SplitURL(rawurl)
+	if err != nil {
+		return err
+	}
+
+	l.Debug().Msgf("serving HTTP validation token on %s%s", host, path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[host+path] = body
+	return nil
+}
+
+// Clean stops serving the tokens of host.
+func (p *ServerPublisher) Clean(ctx context.Context, l zerolog.Logger, host string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k := range p.tokens {
+		if strings.HasPrefix(k, strings.ToLower(host)+"/") {
+			l.Debug().Msgf("not serving HTTP validation token on %s anymore", k)
+			delete(p.tokens, k)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP answers with the token matching the request host and path.
+func (p *ServerPublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	p.mu.RLock()
+	body, ok := p.tokens[strings.ToLower(host)+r.URL.Path]
+	p.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerPublisher(t *testing.T) {
+	p := Init("127.0.0.1", "0")
+	ctx := context.Background()
+	l := zerolog.Nop()
+	if err := p.Publish(ctx, l, "http://www.bar.com/.well-known/pki-validation/abc.txt", "token"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+
+	tests := []struct {
+		name       string
+		host, path string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "published", host: "www.bar.com:80", path: "/.well-known/pki-validation/abc.txt", wantStatus: http.StatusOK, wantBody: "token"},
+		{name: "other host", host: "blog.bar.com", path: "/.well-known/pki-validation/abc.txt", wantStatus: http.StatusNotFound},
+		{name: "other path", host: "www.bar.com", path: "/foo", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if body, _ := io.ReadAll(w.Body); tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("got body '%v', want '%v'", string(body), tt.wantBody)
+			}
+		})
+	}
+
+	if err := p.Clean(ctx, l, "www.bar.com"); err != nil {
+		t.Fatalf("got error '%v'", err)
+	}
+	if len(p.tokens) != 0 {
+		t.Errorf("got %d tokens after cleaning, want 0", len(p.tokens))
+	}
+}